@@ -0,0 +1,131 @@
+package connect
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	internal "github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var bookmarkTags []string
+
+// bookmarkCmd represents the bookmark command
+var bookmarkCmd = &cobra.Command{
+	Use:   "bookmark",
+	Short: "Manage named connect targets",
+	Long: `Bookmarks give a name to a connect target, for example prod-db-bastion,
+which can then be used with "connect <name>".
+
+EC2 bookmarks resolve through instance tags and ECS bookmarks through the
+task's service, so they keep working after the instance or task is
+replaced.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var bookmarkAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Bookmark the most recent connect target",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		t, err := internal.LastTarget()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			return
+		}
+
+		if len(bookmarkTags) > 0 {
+			if t.Kind != "ec2" {
+				fmt.Println(aurora.Bold(aurora.BrightRed("--tag only applies to ec2 targets")))
+				return
+			}
+			t.Tags = map[string]string{}
+			for _, tag := range bookmarkTags {
+				kv := strings.SplitN(tag, "=", 2)
+				if len(kv) != 2 {
+					fmt.Println(aurora.Bold(aurora.BrightRed("Tags must be given as key=value")))
+					return
+				}
+				t.Tags[kv[0]] = kv[1]
+			}
+		}
+		if t.Kind == "ec2" && len(t.Tags) == 0 {
+			fmt.Println(aurora.Bold(aurora.BrightRed("The instance has no Name tag, use --tag to choose tags to match on")))
+			return
+		}
+		if t.Kind == "ecs" && t.Group == "" {
+			fmt.Println(aurora.Bold(aurora.BrightRed("The task has no task group to match on")))
+			return
+		}
+
+		if err := internal.SaveBookmark(args[0], t); err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			return
+		}
+		fmt.Println(aurora.BrightGreen("Bookmarked"), aurora.BrightCyan(t.Label), aurora.BrightGreen("as"), aurora.BrightCyan(args[0]))
+	},
+}
+
+var bookmarkListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List bookmarks",
+	Run: func(cmd *cobra.Command, args []string) {
+		names, bookmarks, err := internal.Bookmarks()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			return
+		}
+		if len(names) == 0 {
+			fmt.Println(aurora.BrightYellow("No bookmarks saved"))
+			return
+		}
+
+		for _, name := range names {
+			t := bookmarks[name]
+			fmt.Printf("%-24s %-4s %-16s %-14s %s\n", aurora.BrightCyan(name), t.Kind, t.Profile, t.Region, describeMatch(t))
+		}
+	},
+}
+
+var bookmarkRmCmd = &cobra.Command{
+	Use:   "rm <name>",
+	Short: "Remove a bookmark",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := internal.RemoveBookmark(args[0]); err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			return
+		}
+		fmt.Println(aurora.BrightGreen("Removed bookmark"), aurora.BrightCyan(args[0]))
+	},
+}
+
+// describeMatch summarises how a bookmark finds its target.
+func describeMatch(t internal.Target) string {
+	if t.Kind == "ecs" {
+		return internal.ShortArn(t.Cluster) + " " + t.Group
+	}
+	keys := []string{}
+	for k := range t.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := []string{}
+	for _, k := range keys {
+		tags = append(tags, "tag:"+k+"="+t.Tags[k])
+	}
+	return strings.Join(tags, " ")
+}
+
+func init() {
+	connectCmd.AddCommand(bookmarkCmd)
+	bookmarkCmd.AddCommand(bookmarkAddCmd)
+	bookmarkCmd.AddCommand(bookmarkListCmd)
+	bookmarkCmd.AddCommand(bookmarkRmCmd)
+
+	bookmarkAddCmd.Flags().StringArrayVar(&bookmarkTags, "tag", nil, "Tag to match ec2 instances on, as key=value (default the Name tag)")
+}
@@ -16,13 +16,18 @@ limitations under the License.
 package connect
 
 import (
+	"fmt"
+
 	"github.com/jjkirkpatrick/awsclihelper/cmd"
+	internal "github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // connectCmd represents the connect command
 var connectCmd = &cobra.Command{
-	Use:   "connect",
+	Use:   "connect [bookmark]",
 	Short: "A brief description of your command",
 	Long: `A longer description that spans multiple lines and likely contains examples
 and usage of using your command. For example:
@@ -30,14 +35,30 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		cmd.Help()
+		if len(args) == 0 {
+			cmd.Help()
+			return
+		}
+
+		t, err := internal.Bookmark(args[0])
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			return
+		}
+		if err := connectTarget(t, false); err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+		}
 	},
 }
 
 func init() {
 	cmd.RootCmd.AddCommand(connectCmd)
 
+	connectCmd.PersistentFlags().Bool("record", false, "Record interactive sessions as asciinema cast files (see the sessions command)")
+	viper.BindPFlag("record", connectCmd.PersistentFlags().Lookup("record"))
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -0,0 +1,277 @@
+package connect
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	internal "github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+// Markers delimit the transfer from whatever else the session prints, such
+// as the plugin banner and shell echo.
+const (
+	cpReady = "__AWSCLIHELPER_READY__"
+	cpSize  = "__AWSCLIHELPER_SIZE__"
+	cpSum   = "__AWSCLIHELPER_SUM__"
+	cpError = "__AWSCLIHELPER_ERROR__"
+)
+
+// base64 line length used for uploads, well under the terminal line limit.
+const cpLineLength = 76
+
+// cpCmd represents the cp command
+var cpCmd = &cobra.Command{
+	Use:   "cp <src> <dst>",
+	Short: "Copy a file to or from an instance over SSM",
+	Long: `Copy a single file between this machine and an SSM managed Linux
+instance, without SSH. One of src or dst is remote, written as
+<instance>:<path> where instance is an instance ID or Name tag. Leave the
+instance empty, as in :/var/log/messages, to choose it from a list.
+
+  awsclihelper connect cp ./app.conf web-1:/etc/app/app.conf
+  awsclihelper connect cp :/var/log/app.log ./app.log
+
+The file is sent base64 encoded through an interactive session and its
+SHA-256 checksum is verified on both ends.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		srcHost, srcPath, srcRemote := splitRemote(args[0])
+		dstHost, dstPath, dstRemote := splitRemote(args[1])
+		if srcRemote == dstRemote {
+			fmt.Println(aurora.Bold(aurora.BrightRed("Exactly one of src and dst must be <instance>:<path>")))
+			os.Exit(1)
+		}
+
+		clients, err := internal.NewClients()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		internal.RegionHeader(clients)
+
+		host := dstHost
+		if srcRemote {
+			host = srcHost
+		}
+		instance, err := findInstance(clients, host)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		if srcRemote {
+			err = download(instance.Client, instance.ID, srcPath, dstPath)
+		} else {
+			err = upload(instance.Client, instance.ID, srcPath, dstPath)
+		}
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+	},
+}
+
+// splitRemote parses <instance>:<path>. Single letter prefixes are treated
+// as Windows drive letters rather than instances.
+func splitRemote(arg string) (string, string, bool) {
+	i := strings.Index(arg, ":")
+	if i == -1 || i == 1 {
+		return "", arg, false
+	}
+	return arg[:i], arg[i+1:], true
+}
+
+// startShell runs script on the instance through AWS-StartInteractiveCommand
+// with piped rather than terminal stdin and stdout.
+func startShell(c *internal.Client, instanceID string, script string) (*exec.Cmd, io.WriteCloser, *bufio.Scanner, error) {
+	params, _ := json.Marshal(map[string][]string{"command": {"sh -c " + internal.ShellQuote(script)}})
+	args := append([]string{
+		"ssm", "start-session",
+		"--target=" + instanceID,
+		"--document-name=AWS-StartInteractiveCommand",
+		"--parameters=" + string(params),
+	}, c.CLIArgs()...)
+
+	cmd := exec.Command("aws", args...)
+	cmd.Env = c.CLIEnv()
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return cmd, stdin, scanner, nil
+}
+
+// scanLine returns the next line of session output without the carriage
+// return the remote terminal adds.
+func scanLine(scanner *bufio.Scanner) (string, error) {
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.ErrUnexpectedEOF
+	}
+	return strings.TrimRight(scanner.Text(), "\r"), nil
+}
+
+// waitFor skips session output until a line starting with marker, returning
+// the rest of that line.
+func waitFor(scanner *bufio.Scanner, marker string) (string, error) {
+	for {
+		line, err := scanLine(scanner)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(line, cpError) {
+			return "", errors.New(strings.TrimSpace(strings.TrimPrefix(line, cpError)))
+		}
+		if i := strings.Index(line, marker); i != -1 {
+			return strings.TrimSpace(line[i+len(marker):]), nil
+		}
+	}
+}
+
+func upload(c *internal.Client, instanceID string, localPath string, remotePath string) error {
+	data, err := ioutil.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+
+	// Echo is turned off before announcing readiness so the encoded file
+	// isn't sent straight back. Ctrl-D at the start of a line ends input.
+	script := fmt.Sprintf(`stty -echo
+printf '%%s\n' %s
+base64 -d > "$1.part" && mv "$1.part" "$1" || { printf '%%s %%s\n' %s "unable to write $1"; exit 1; }
+printf '%%s %%s\n' %s "$(sha256sum "$1" | cut -d' ' -f1)"`, cpReady, cpError, cpSum)
+	script = fmt.Sprintf("set -- %s\n%s", internal.ShellQuote(remotePath), script)
+
+	cmd, stdin, scanner, err := startShell(c, instanceID, script)
+	if err != nil {
+		return err
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+
+	if _, err := waitFor(scanner, cpReady); err != nil {
+		return err
+	}
+
+	progress := &internal.Progress{Label: filepath.Base(localPath), Total: int64(len(data)), Out: os.Stderr}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for i := 0; i < len(encoded); i += cpLineLength {
+		end := i + cpLineLength
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		if _, err := io.WriteString(stdin, encoded[i:end]+"\n"); err != nil {
+			return err
+		}
+		progress.Add(int64((end - i) * 3 / 4))
+	}
+	progress.Finish()
+	if _, err := io.WriteString(stdin, "\x04"); err != nil {
+		return err
+	}
+
+	remoteSum, err := waitFor(scanner, cpSum)
+	if err != nil {
+		return err
+	}
+	if remoteSum != hex.EncodeToString(sum[:]) {
+		return fmt.Errorf("checksum mismatch: local %x, remote %s", sum, remoteSum)
+	}
+
+	fmt.Println(aurora.BrightGreen("Copied"), aurora.BrightCyan(localPath), aurora.BrightGreen("to"), aurora.BrightCyan(instanceID+":"+remotePath), aurora.Faint("sha256 "+remoteSum))
+	return nil
+}
+
+func download(c *internal.Client, instanceID string, remotePath string, localPath string) error {
+	script := fmt.Sprintf(`[ -r "$1" ] || { printf '%%s %%s\n' %s "unable to read $1"; exit 1; }
+printf '%%s %%s\n' %s "$(wc -c < "$1")"
+printf '%%s\n' %s
+base64 "$1"
+printf '%%s %%s\n' %s "$(sha256sum "$1" | cut -d' ' -f1)"`, cpError, cpSize, cpReady, cpSum)
+	script = fmt.Sprintf("set -- %s\n%s", internal.ShellQuote(remotePath), script)
+
+	cmd, stdin, scanner, err := startShell(c, instanceID, script)
+	if err != nil {
+		return err
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+
+	size, err := waitFor(scanner, cpSize)
+	if err != nil {
+		return err
+	}
+	total, _ := strconv.ParseInt(size, 10, 64)
+	if _, err := waitFor(scanner, cpReady); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+		localPath = filepath.Join(localPath, filepath.Base(remotePath))
+	}
+	progress := &internal.Progress{Label: filepath.Base(remotePath), Total: total, Out: os.Stderr}
+
+	var encoded bytes.Buffer
+	remoteSum := ""
+	for remoteSum == "" {
+		line, err := scanLine(scanner)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, cpSum) {
+			remoteSum = strings.TrimSpace(strings.TrimPrefix(line, cpSum))
+			continue
+		}
+		encoded.WriteString(line)
+		progress.Add(int64(len(line) * 3 / 4))
+	}
+	progress.Finish()
+
+	data, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if remoteSum != hex.EncodeToString(sum[:]) {
+		return fmt.Errorf("checksum mismatch: remote %s, local %x", remoteSum, sum)
+	}
+	if err := ioutil.WriteFile(localPath, data, 0644); err != nil {
+		return err
+	}
+
+	fmt.Println(aurora.BrightGreen("Copied"), aurora.BrightCyan(instanceID+":"+remotePath), aurora.BrightGreen("to"), aurora.BrightCyan(localPath), aurora.Faint("sha256 "+remoteSum))
+	return nil
+}
+
+func init() {
+	connectCmd.AddCommand(cpCmd)
+}
@@ -0,0 +1,428 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	internal "github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+)
+
+// checkResult is the outcome of one ECS exec preflight check.
+type checkResult int
+
+const (
+	checkPassed checkResult = iota
+	checkWarning
+	checkFailed
+)
+
+type check struct {
+	name   string
+	result checkResult
+	detail string
+}
+
+// execActions are the permissions the task role needs for the exec agent
+// to open its channels.
+var execActions = []string{
+	"ssmmessages:CreateControlChannel",
+	"ssmmessages:CreateDataChannel",
+	"ssmmessages:OpenControlChannel",
+	"ssmmessages:OpenDataChannel",
+}
+
+const (
+	// Fargate Linux tasks need platform version 1.4.0 for exec, and EC2
+	// container instances need agent 1.50.2.
+	minFargateVersion = "1.4.0"
+	minAgentVersion   = "1.50.2"
+)
+
+// maxDiagnosed is how many tasks are explained when none can be exec'd into.
+const maxDiagnosed = 5
+
+// diagnoseTask runs every preflight check against a task.
+func diagnoseTask(c *internal.Client, clusterArn string, task types.Task) []check {
+	checks := []check{}
+	cluster := describeExecCluster(c, clusterArn)
+
+	checks = append(checks, checkPlugin())
+	checks = append(checks, checkExecEnabled(c, clusterArn, task))
+	checks = append(checks, checkAgent(task))
+	checks = append(checks, checkPlatform(c, clusterArn, task))
+	checks = append(checks, checkTaskRole(c, task, cluster))
+	checks = append(checks, checkLogging(cluster))
+	return checks
+}
+
+func checkPlugin() check {
+	c := check{name: "Session Manager plugin"}
+	if path, err := exec.LookPath("session-manager-plugin"); err != nil {
+		c.result = checkFailed
+		c.detail = "session-manager-plugin is not on PATH, install it to use exec"
+	} else {
+		c.detail = path
+	}
+	return c
+}
+
+func checkExecEnabled(c *internal.Client, clusterArn string, task types.Task) check {
+	result := check{name: "Execute command enabled"}
+	if task.EnableExecuteCommand {
+		result.detail = "enabled on the task"
+		return result
+	}
+
+	result.result = checkFailed
+	group := aws.ToString(task.Group)
+	if !strings.HasPrefix(group, "service:") {
+		result.detail = "the task was started without --enable-execute-command"
+		return result
+	}
+
+	service := strings.TrimPrefix(group, "service:")
+	output, err := c.ECS.DescribeServices(context.TODO(), &ecs.DescribeServicesInput{
+		Cluster:  aws.String(clusterArn),
+		Services: []string{service},
+	})
+	if err == nil && len(output.Services) == 1 && output.Services[0].EnableExecuteCommand {
+		result.detail = fmt.Sprintf("enabled on service %s, but this task started before it was, redeploy with: awsclihelper ecs service redeploy -s %s", service, service)
+	} else {
+		result.detail = fmt.Sprintf("not enabled on service %s, enable it with: aws ecs update-service --service %s --enable-execute-command --force-new-deployment", service, service)
+	}
+	return result
+}
+
+// canExec reports whether a task looks ready for exec: it was started with
+// execute command enabled and a container is running the exec agent.
+func canExec(task types.Task) bool {
+	if !task.EnableExecuteCommand {
+		return false
+	}
+	for _, container := range task.Containers {
+		for _, agent := range container.ManagedAgents {
+			if agent.Name == types.ManagedAgentNameExecuteCommandAgent && aws.ToString(agent.LastStatus) == "RUNNING" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func checkAgent(task types.Task) check {
+	result := check{name: "ExecuteCommandAgent"}
+	statuses := []string{}
+	running := 0
+	for _, container := range task.Containers {
+		for _, agent := range container.ManagedAgents {
+			if agent.Name != types.ManagedAgentNameExecuteCommandAgent {
+				continue
+			}
+			status := aws.ToString(agent.LastStatus)
+			if status == "RUNNING" {
+				running++
+			}
+			detail := aws.ToString(container.Name) + " " + strings.ToLower(status)
+			if reason := aws.ToString(agent.Reason); reason != "" {
+				detail += " (" + reason + ")"
+			}
+			statuses = append(statuses, detail)
+		}
+	}
+
+	switch {
+	case len(statuses) == 0:
+		result.result = checkFailed
+		result.detail = "no container is running the agent"
+	case running == 0:
+		result.result = checkFailed
+		result.detail = strings.Join(statuses, ", ")
+	case running < len(statuses):
+		result.result = checkWarning
+		result.detail = strings.Join(statuses, ", ")
+	default:
+		result.detail = strings.Join(statuses, ", ")
+	}
+	return result
+}
+
+func checkPlatform(c *internal.Client, clusterArn string, task types.Task) check {
+	result := check{name: "Platform version"}
+
+	switch task.LaunchType {
+	case types.LaunchTypeFargate:
+		version := aws.ToString(task.PlatformVersion)
+		result.detail = "Fargate " + version
+		if version != "LATEST" && strings.EqualFold(aws.ToString(task.PlatformFamily), "Linux") && olderThan(version, minFargateVersion) {
+			result.result = checkFailed
+			result.detail += ", exec needs " + minFargateVersion + " or later"
+		}
+	case types.LaunchTypeEc2, types.LaunchTypeExternal:
+		if task.ContainerInstanceArn == nil {
+			result.result = checkWarning
+			result.detail = "container instance unknown"
+			return result
+		}
+		output, err := c.ECS.DescribeContainerInstances(context.TODO(), &ecs.DescribeContainerInstancesInput{
+			Cluster:            aws.String(clusterArn),
+			ContainerInstances: []string{*task.ContainerInstanceArn},
+		})
+		if err != nil || len(output.ContainerInstances) == 0 || output.ContainerInstances[0].VersionInfo == nil {
+			result.result = checkWarning
+			result.detail = "unable to read the container agent version"
+			return result
+		}
+		version := aws.ToString(output.ContainerInstances[0].VersionInfo.AgentVersion)
+		result.detail = "ECS agent " + version
+		if olderThan(version, minAgentVersion) {
+			result.result = checkFailed
+			result.detail += ", exec needs " + minAgentVersion + " or later"
+		}
+	default:
+		result.result = checkWarning
+		result.detail = "unknown launch type " + string(task.LaunchType)
+	}
+	return result
+}
+
+// olderThan compares dotted version numbers, ignoring any leading v.
+func olderThan(version string, min string) bool {
+	a := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	b := strings.Split(min, ".")
+	for i := 0; i < len(b); i++ {
+		x, y := 0, 0
+		if i < len(a) {
+			x, _ = strconv.Atoi(a[i])
+		}
+		y, _ = strconv.Atoi(b[i])
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+func checkTaskRole(c *internal.Client, task types.Task, cluster *types.Cluster) check {
+	result := check{name: "Task role permissions"}
+
+	role := ""
+	if task.Overrides != nil {
+		role = aws.ToString(task.Overrides.TaskRoleArn)
+	}
+	if role == "" {
+		output, err := c.ECS.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: task.TaskDefinitionArn,
+		})
+		if err == nil && output.TaskDefinition != nil {
+			role = aws.ToString(output.TaskDefinition.TaskRoleArn)
+		}
+	}
+	if role == "" {
+		result.result = checkFailed
+		result.detail = "the task has no task role, the agent needs one allowing " + strings.Join(execActions, ", ")
+		return result
+	}
+
+	actions := append([]string{}, execActions...)
+	if cluster != nil && cluster.Configuration != nil && cluster.Configuration.ExecuteCommandConfiguration != nil {
+		config := cluster.Configuration.ExecuteCommandConfiguration
+		if config.KmsKeyId != nil {
+			actions = append(actions, "kms:Decrypt")
+		}
+		if config.Logging == types.ExecuteCommandLoggingOverride && config.LogConfiguration != nil {
+			if config.LogConfiguration.CloudWatchLogGroupName != nil {
+				actions = append(actions, "logs:DescribeLogGroups", "logs:CreateLogStream", "logs:DescribeLogStreams", "logs:PutLogEvents")
+			}
+			if config.LogConfiguration.S3BucketName != nil {
+				actions = append(actions, "s3:PutObject", "s3:GetEncryptionConfiguration")
+			}
+		}
+	}
+
+	decisions, err := c.SimulatePrincipalPolicy(context.TODO(), role, actions)
+	if err != nil {
+		result.result = checkWarning
+		result.detail = fmt.Sprintf("unable to simulate %s: %s", role, err)
+		return result
+	}
+
+	denied := []string{}
+	for _, action := range actions {
+		if decisions[action] != "allowed" {
+			denied = append(denied, action)
+		}
+	}
+	if len(denied) > 0 {
+		result.result = checkFailed
+		result.detail = fmt.Sprintf("%s is not allowed %s", role, strings.Join(denied, ", "))
+		return result
+	}
+	result.detail = role + " has the required permissions"
+	return result
+}
+
+func describeExecCluster(c *internal.Client, clusterArn string) *types.Cluster {
+	output, err := c.ECS.DescribeClusters(context.TODO(), &ecs.DescribeClustersInput{
+		Clusters: []string{clusterArn},
+		Include:  []types.ClusterField{types.ClusterFieldConfigurations},
+	})
+	if err != nil || len(output.Clusters) == 0 {
+		return nil
+	}
+	return &output.Clusters[0]
+}
+
+func checkLogging(cluster *types.Cluster) check {
+	result := check{name: "Cluster exec logging"}
+	if cluster == nil {
+		result.result = checkWarning
+		result.detail = "unable to describe the cluster"
+		return result
+	}
+	if cluster.Configuration == nil || cluster.Configuration.ExecuteCommandConfiguration == nil {
+		result.detail = "default, logged to the task's awslogs configuration if any"
+		return result
+	}
+
+	config := cluster.Configuration.ExecuteCommandConfiguration
+	switch config.Logging {
+	case types.ExecuteCommandLoggingNone:
+		result.detail = "disabled"
+	case types.ExecuteCommandLoggingOverride:
+		destinations := []string{}
+		if log := config.LogConfiguration; log != nil {
+			if log.CloudWatchLogGroupName != nil {
+				destinations = append(destinations, "CloudWatch log group "+*log.CloudWatchLogGroupName)
+			}
+			if log.S3BucketName != nil {
+				destinations = append(destinations, "S3 bucket "+*log.S3BucketName)
+			}
+		}
+		if len(destinations) == 0 {
+			result.result = checkWarning
+			result.detail = "override logging is set without a destination"
+		} else {
+			result.detail = "logged to " + strings.Join(destinations, " and ") + ", which the task role must be able to write to"
+		}
+	default:
+		result.detail = "default, logged to the task's awslogs configuration if any"
+	}
+	if config.KmsKeyId != nil {
+		result.detail += ", encrypted with " + *config.KmsKeyId
+	}
+	return result
+}
+
+// printChecks prints check results, leaving out passed checks unless all
+// is set.
+func printChecks(checks []check, all bool) {
+	for _, c := range checks {
+		switch {
+		case c.result == checkFailed:
+			fmt.Println("  ", aurora.BrightRed("✗ "+c.name+":"), c.detail)
+		case c.result == checkWarning:
+			fmt.Println("  ", aurora.BrightYellow("! "+c.name+":"), c.detail)
+		case all:
+			fmt.Println("  ", aurora.BrightGreen("✓ "+c.name+":"), aurora.Faint(c.detail))
+		}
+	}
+}
+
+// diagnose lists every task in a cluster, including those that can't be
+// exec'd into, and runs the preflight checks against the chosen one.
+func diagnose(clients []*internal.Client) {
+	clusterArn, c := getClusters(clients)
+	tasks, err := describeAllTasks(c, clusterArn)
+	if err != nil {
+		fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+		return
+	}
+	if len(tasks) == 0 {
+		fmt.Println(aurora.Bold(aurora.BrightRed("No running tasks found")))
+		return
+	}
+
+	items := []internal.Item{}
+	byArn := map[string]types.Task{}
+	for _, task := range tasks {
+		items = append(items, taskItem(task))
+		byArn[aws.ToString(task.TaskArn)] = task
+	}
+	choice, err := internal.Pick("Which ECS Task would you like to diagnose?:", "ecs-task", items)
+	if err != nil {
+		fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+		return
+	}
+
+	fmt.Println(aurora.Bold("Exec preflight checks for"), aurora.BrightCyan(choice.Label))
+	printChecks(diagnoseTask(c, clusterArn, byArn[choice.ID]), true)
+}
+
+// explainNoTasks says why none of a cluster's tasks can be exec'd into.
+func explainNoTasks(c *internal.Client, clusterArn string, tasks []types.Task) {
+	fmt.Println(aurora.Bold(aurora.BrightRed(fmt.Sprintf("None of the %d running tasks can be connected to", len(tasks)))))
+	explainTasks(c, clusterArn, tasks)
+}
+
+// explainSkippedTasks says why some of a cluster's tasks were left out of
+// the list to connect to.
+func explainSkippedTasks(c *internal.Client, clusterArn string, tasks []types.Task) {
+	fmt.Println(aurora.Bold(aurora.BrightYellow(fmt.Sprintf("%d running tasks can't be connected to and aren't listed", len(tasks)))))
+	explainTasks(c, clusterArn, tasks)
+}
+
+// explainTasks prints the failed checks of a task from each group.
+func explainTasks(c *internal.Client, clusterArn string, tasks []types.Task) {
+	sort.Slice(tasks, func(i, j int) bool { return aws.ToString(tasks[i].Group) < aws.ToString(tasks[j].Group) })
+	shown := map[string]bool{}
+	for _, task := range tasks {
+		// Tasks in the same service almost always fail for the same reason.
+		group := aws.ToString(task.Group)
+		if shown[group] || len(shown) == maxDiagnosed {
+			continue
+		}
+		shown[group] = true
+
+		fmt.Println(aurora.Bold(group), aurora.Faint(aws.ToString(task.TaskArn)))
+		printChecks(diagnoseTask(c, clusterArn, task), false)
+	}
+}
+
+// describeAllTasks describes every running task in a cluster.
+func describeAllTasks(c *internal.Client, clusterArn string) ([]types.Task, error) {
+	arns := []string{}
+	paginator := ecs.NewListTasksPaginator(c.ECS, &ecs.ListTasksInput{Cluster: aws.String(clusterArn)})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		arns = append(arns, output.TaskArns...)
+	}
+
+	tasks := []types.Task{}
+	// DescribeTasks accepts at most 100 tasks per call.
+	for i := 0; i < len(arns); i += 100 {
+		end := i + 100
+		if end > len(arns) {
+			end = len(arns)
+		}
+		output, err := c.ECS.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
+			Cluster: aws.String(clusterArn),
+			Tasks:   arns[i:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, output.Tasks...)
+	}
+	return tasks, nil
+}
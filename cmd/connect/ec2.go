@@ -18,16 +18,19 @@ package connect
 import (
 	"context"
 	"fmt"
-	"log"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
 	internal "github.com/jjkirkpatrick/awsclihelper/internal"
 	"github.com/logrusorgru/aurora"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 type execCommand struct {
@@ -38,6 +41,9 @@ type execCommand struct {
 	profile   string
 }
 
+var showAllInstances bool
+var onlineOnly bool
+
 // ec2Cmd represents the ec2 command
 var ec2Cmd = &cobra.Command{
 	Use:   "ec2",
@@ -49,74 +55,256 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		c, _ := internal.NewClient()
-		c.CmdHeader()
-		connect(c)
+		clients, err := internal.NewClients()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			return
+		}
+		internal.RegionHeader(clients)
+		connect(clients)
 	},
 }
 
-func getManagedInstances(c *internal.Client) []string {
-	result, err := c.SSM.DescribeInstanceInformation(context.TODO(), &ssm.DescribeInstanceInformationInput{})
-	if err != nil {
-		log.Fatal(err)
+func getManagedInstances(c *internal.Client) []internal.Item {
+	infos := []ssmtypes.InstanceInformation{}
+	paginator := ssm.NewDescribeInstanceInformationPaginator(c.SSM, &ssm.DescribeInstanceInformationInput{})
+	for paginator.HasMorePages() {
+		result, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.BrightRed(fmt.Sprintf("%s: %s", c.Region, err)))
+			return nil
+		}
+		infos = append(infos, result.InstanceInformationList...)
+	}
+	if len(infos) == 0 {
+		return nil
 	}
 
+	// Hybrid activations (mi-) have no EC2 instance to describe.
 	instanceIDs := []string{}
-
-	for _, instance := range result.InstanceInformationList {
-		instanceIDs = append(instanceIDs, *instance.InstanceId)
+	for _, info := range infos {
+		if strings.HasPrefix(*info.InstanceId, "i-") {
+			instanceIDs = append(instanceIDs, *info.InstanceId)
+		}
 	}
 
-	instanceInfo, err := c.EC2.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{
-		InstanceIds: instanceIDs,
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-	managedInstances := []string{}
-	for _, reservation := range instanceInfo.Reservations {
-		for _, instance := range reservation.Instances {
-			for _, tag := range instance.Tags {
-				if *tag.Key == "Name" {
-					managedInstances = append(managedInstances, *instance.InstanceId+" : "+*tag.Value)
+	ec2Instances := map[string]types.Instance{}
+	if len(instanceIDs) > 0 {
+		paginator := ec2.NewDescribeInstancesPaginator(c.EC2, &ec2.DescribeInstancesInput{
+			InstanceIds: instanceIDs,
+		})
+		for paginator.HasMorePages() {
+			instanceInfo, err := paginator.NextPage(context.TODO())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, aurora.BrightRed(fmt.Sprintf("%s: %s", c.Region, err)))
+				return nil
+			}
+			for _, reservation := range instanceInfo.Reservations {
+				for _, instance := range reservation.Instances {
+					ec2Instances[*instance.InstanceId] = instance
 				}
 			}
 		}
 	}
+
+	managedInstances := []internal.Item{}
+	for _, info := range infos {
+		instance, isEC2 := ec2Instances[*info.InstanceId]
+		if isEC2 && !showAllInstances && instance.State.Name != types.InstanceStateNameRunning {
+			continue
+		}
+		if onlineOnly && info.PingStatus != ssmtypes.PingStatusOnline {
+			continue
+		}
+		if isEC2 {
+			managedInstances = append(managedInstances, instanceItem(info, &instance))
+		} else {
+			managedInstances = append(managedInstances, instanceItem(info, nil))
+		}
+	}
 	return managedInstances
 }
 
-func connect(c *internal.Client) {
-	fmt.Println(aurora.Bold(aurora.BrightGreen("EC2 Connect. Running with Profile ")), aurora.BrightCyan(viper.GetString("profile")), aurora.BrightGreen("and Region "), aurora.BrightCyan(viper.GetString("region")))
-	managedInstances := getManagedInstances(c)
+// instanceName returns the Name tag, falling back to the host name the SSM
+// agent reports and then the instance ID.
+func instanceName(info ssmtypes.InstanceInformation, instance *types.Instance) string {
+	if instance != nil {
+		for _, tag := range instance.Tags {
+			if aws.ToString(tag.Key) == "Name" && aws.ToString(tag.Value) != "" {
+				return aws.ToString(tag.Value)
+			}
+		}
+	}
+	if aws.ToString(info.ComputerName) != "" {
+		return aws.ToString(info.ComputerName)
+	}
+	return aws.ToString(info.InstanceId)
+}
+
+// instanceItem builds the picker entry for an instance. The first field is
+// always the instance name.
+func instanceItem(info ssmtypes.InstanceInformation, instance *types.Instance) internal.Item {
+	id := aws.ToString(info.InstanceId)
+	name := instanceName(info, instance)
+
+	state, ip, az, instanceType, launched := "managed", aws.ToString(info.IPAddress), "", "", ""
+	if instance != nil {
+		state = string(instance.State.Name)
+		ip = aws.ToString(instance.PrivateIpAddress)
+		az = aws.ToString(instance.Placement.AvailabilityZone)
+		instanceType = string(instance.InstanceType)
+		if instance.LaunchTime != nil {
+			launched = instance.LaunchTime.Local().Format("2006-01-02 15:04")
+		}
+	}
+
+	agent := aws.ToString(info.AgentVersion)
+	if !info.IsLatestVersion {
+		agent += " (update available)"
+	}
+
+	item := internal.Item{
+		ID: id,
+		Label: fmt.Sprintf("%s : %s  %s", id, name, strings.Join(nonEmpty(
+			state, string(info.PingStatus), ip, az, instanceType, launched,
+		), "  ")),
+		Fields: []string{name, ip, az, instanceType, string(info.PlatformType), aws.ToString(info.PlatformName)},
+		Preview: []string{
+			"Instance  " + id,
+			"Name      " + name,
+			"State     " + state,
+			"Ping      " + string(info.PingStatus),
+			"Platform  " + strings.TrimSpace(aws.ToString(info.PlatformName)+" "+aws.ToString(info.PlatformVersion)),
+			"Agent     " + agent,
+			"IP        " + ip,
+		},
+	}
+	if instance != nil {
+		item.Preview = append(item.Preview,
+			"Public IP "+aws.ToString(instance.PublicIpAddress),
+			"AZ        "+az,
+			"Type      "+instanceType,
+			"Launched  "+launched,
+			"Tags",
+		)
+		for _, tag := range instance.Tags {
+			item.Fields = append(item.Fields, aws.ToString(tag.Value))
+			item.Preview = append(item.Preview, fmt.Sprintf("  %s = %s", aws.ToString(tag.Key), aws.ToString(tag.Value)))
+		}
+	}
+	return item
+}
+
+func nonEmpty(values ...string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// describeTarget fetches the SSM and EC2 details of an instance. Either
+// may be nil if the lookup fails or, for hybrid activations, doesn't apply.
+func describeTarget(c *internal.Client, instanceID string) (*ssmtypes.InstanceInformation, *types.Instance) {
+	var info *ssmtypes.InstanceInformation
+	output, err := c.SSM.DescribeInstanceInformation(context.TODO(), &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{{
+			Key:    aws.String("InstanceIds"),
+			Values: []string{instanceID},
+		}},
+	})
+	if err == nil && len(output.InstanceInformationList) == 1 {
+		info = &output.InstanceInformationList[0]
+	}
 
-	choice := ""
-	prompt := &survey.Select{
-		Message: "Choose a pipeline:",
-		Options: managedInstances,
+	var instance *types.Instance
+	if strings.HasPrefix(instanceID, "i-") {
+		output, err := c.EC2.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{
+			InstanceIds: []string{instanceID},
+		})
+		if err == nil && len(output.Reservations) == 1 && len(output.Reservations[0].Instances) == 1 {
+			instance = &output.Reservations[0].Instances[0]
+		}
 	}
+	return info, instance
+}
 
-	survey.AskOne(prompt, &choice)
+// confirmInstance warns about instances that are unlikely to accept a
+// session, returning false if the user chooses not to continue.
+func confirmInstance(info *ssmtypes.InstanceInformation) bool {
+	if info == nil {
+		return true
+	}
 
-	fmt.Println(aurora.Bold(aurora.BrightGreen("Connecting to ")), aurora.BrightCyan(choice))
-	instanceID := strings.Split(choice, " : ")[0]
-	arg0 := "aws"
-	arg1 := "ssm"
-	arg2 := "start-session"
-	arg3 := "--target=" + instanceID
-	arg4 := "--document-name=AWS-StartInteractiveCommand"
-	arg5 := "--parameters=command=[\"sudo -i -u root\"]"
-	arg6 := "--region=" + c.Region
-	arg7 := "--profile=" + c.Profile
+	warnings := []string{}
+	if info.PingStatus != ssmtypes.PingStatusOnline {
+		last := "never"
+		if info.LastPingDateTime != nil {
+			last = info.LastPingDateTime.Local().Format(time.RFC1123)
+		}
+		warnings = append(warnings, fmt.Sprintf("The SSM agent is %s, last seen %s", info.PingStatus, last))
+	}
+	if !info.IsLatestVersion {
+		warnings = append(warnings, fmt.Sprintf("The SSM agent %s is outdated", aws.ToString(info.AgentVersion)))
+	}
+	if len(warnings) == 0 {
+		return true
+	}
 
-	if err := internal.RunCommand(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7); err != nil {
+	for _, warning := range warnings {
+		fmt.Println(aurora.BrightYellow("Warning: " + warning))
+	}
+	confirmation := false
+	prompt := &survey.Confirm{
+		Message: "Connect anyway?",
+		Default: info.PingStatus == ssmtypes.PingStatusOnline,
+	}
+	survey.AskOne(prompt, &confirmation)
+	return confirmation
+}
+
+func connect(clients []*internal.Client) {
+	managedInstances := internal.Labelled(clients, getManagedInstances)
+
+	choice, err := internal.Pick("Choose an instance:", "ec2", managedInstances)
+	if err != nil {
+		fmt.Println(aurora.Bold(aurora.BrightRed(err)))
 		return
 	}
 
-	fmt.Println(aurora.Bold(aurora.BrightGreen("Disconnected from ")), aurora.BrightCyan(choice))
+	startSession(choice.Client, choice.ID, choice.ID+" : "+choice.Fields[0])
+}
+
+func startSession(c *internal.Client, instanceID string, label string) {
+	info, instance := describeTarget(c, instanceID)
+	if !confirmInstance(info) {
+		return
+	}
+	settings := resolveSessionSettings(c, info, instance)
+
+	fmt.Println(aurora.Bold(aurora.BrightGreen("Connecting to ")), aurora.BrightCyan(label))
+	recordInstance(c, instanceID, label, instance)
+
+	args := []string{"ssm", "start-session", "--target=" + instanceID}
+	args = append(args, settings.args()...)
+	args = append(args, c.CLIArgs()...)
+
+	if err := c.RunSession(instanceID, settings.document(), true, "aws", args...); err != nil {
+		return
+	}
+
+	fmt.Println(aurora.Bold(aurora.BrightGreen("Disconnected from ")), aurora.BrightCyan(label))
 
 }
 
 func init() {
 	connectCmd.AddCommand(ec2Cmd)
+
+	ec2Cmd.Flags().BoolVarP(&showAllInstances, "all", "a", false, "Include instances that aren't running")
+	ec2Cmd.Flags().BoolVar(&onlineOnly, "online", false, "Only include instances whose SSM agent is online")
+	ec2Cmd.Flags().StringVar(&sessionFlags.Document, "document", "", "Session document to start, e.g. AWS-StartInteractiveCommand")
+	ec2Cmd.Flags().StringVar(&sessionFlags.Parameters, "parameters", "", `Session document parameters, e.g. 'command=["bash -l"]'`)
+	ec2Cmd.Flags().StringVarP(&sessionFlags.User, "user", "u", "", "User to log in as on Linux instances")
 }
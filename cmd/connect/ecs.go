@@ -19,15 +19,18 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
+	"time"
 
-	"github.com/AlecAivazis/survey/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	internal "github.com/jjkirkpatrick/awsclihelper/internal"
 	"github.com/logrusorgru/aurora"
 	"github.com/spf13/cobra"
 )
 
+var ecsDiagnose bool
+
 // ecsCmd represents the ecs command
 var ecsCmd = &cobra.Command{
 	Use:   "ecs",
@@ -39,43 +42,60 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		c, _ := internal.NewClient()
-		c.CmdHeader()
-		ecsConnect(c)
+		clients, err := internal.NewClients()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			return
+		}
+		internal.RegionHeader(clients)
+		if ecsDiagnose {
+			diagnose(clients)
+			return
+		}
+		ecsConnect(clients)
 	},
 }
 
-func getClusters(c *internal.Client) string {
+func listClusters(c *internal.Client) []internal.Item {
 
 	input := &ecs.ListClustersInput{}
 
 	result, err := c.ECS.ListClusters(context.TODO(), input)
 
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(0)
+		fmt.Println(aurora.BrightRed(fmt.Sprintf("%s: %s", c.Region, err)))
+		return nil
 	}
 
-	for _, cluster := range result.ClusterArns {
-		fmt.Println(cluster)
+	clusters := []internal.Item{}
+	for _, arn := range result.ClusterArns {
+		clusters = append(clusters, internal.Item{
+			ID:      arn,
+			Label:   internal.ShortArn(arn),
+			Fields:  []string{arn},
+			Preview: []string{"Cluster  " + arn},
+		})
 	}
+	return clusters
+}
 
-	if len(result.ClusterArns) == 1 {
-		return result.ClusterArns[0]
-	} else if len(result.ClusterArns) < 1 {
+func getClusters(clients []*internal.Client) (string, *internal.Client) {
+	clusters := internal.Labelled(clients, listClusters)
+
+	if len(clusters) == 1 {
+		return clusters[0].ID, clusters[0].Client
+	} else if len(clusters) < 1 {
 		fmt.Println(aurora.Bold(aurora.BrightRed("No clusters found, please check profile and region")))
 		os.Exit(0)
 	}
 
-	choice := ""
-	prompt := &survey.Select{
-		Message: "Which ECS Cluster is the task in?:",
-		Options: result.ClusterArns,
+	choice, err := internal.Pick("Which ECS Cluster is the task in?:", "ecs-cluster", clusters)
+	if err != nil {
+		fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+		os.Exit(1)
 	}
 
-	survey.AskOne(prompt, &choice)
-
-	return choice
+	return choice.ID, choice.Client
 
 }
 
@@ -101,31 +121,70 @@ func getTasks(e *internal.Client, clusterArn string) string {
 	describeTaskResult, err := e.ECS.DescribeTasks(context.TODO(), describeTaskinput)
 	if err != nil {
 		fmt.Println(aurora.Bold(aurora.BrightRed("Error describing tasks")))
+		os.Exit(1)
 	}
 
-	validTasks := []string{}
+	validTasks := []internal.Item{}
+	skipped := []types.Task{}
 	for _, task := range describeTaskResult.Tasks {
-		if task.Containers[0].ManagedAgents != nil {
-			validTasks = append(validTasks, *task.Containers[0].Name+" : "+*task.TaskArn)
+		if canExec(task) {
+			validTasks = append(validTasks, taskItem(task))
+		} else {
+			skipped = append(skipped, task)
 		}
 	}
+	if len(validTasks) == 0 {
+		explainNoTasks(e, clusterArn, describeTaskResult.Tasks)
+		os.Exit(1)
+	}
+	if len(skipped) > 0 {
+		explainSkippedTasks(e, clusterArn, skipped)
+	}
 
-	choice := ""
-	prompt := &survey.Select{
-		Message: "Which ECS Task would you like to connect to?:",
-		Options: validTasks,
+	choice, err := internal.Pick("Which ECS Task would you like to connect to?:", "ecs-task", validTasks)
+	if err != nil {
+		fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+		os.Exit(1)
 	}
 
-	survey.AskOne(prompt, &choice)
+	return choice.ID
 
-	return choice
+}
 
+func taskItem(task types.Task) internal.Item {
+	taskDefinition := aws.ToString(task.TaskDefinitionArn)
+	item := internal.Item{
+		ID:     *task.TaskArn,
+		Label:  *task.Containers[0].Name + " : " + *task.TaskArn,
+		Fields: []string{taskDefinition, aws.ToString(task.Group)},
+		Preview: []string{
+			"Task        " + *task.TaskArn,
+			"Definition  " + internal.ShortArn(taskDefinition),
+			"Group       " + aws.ToString(task.Group),
+			"Status      " + aws.ToString(task.LastStatus),
+			"Launch type " + string(task.LaunchType),
+		},
+	}
+	if task.StartedAt != nil {
+		item.Preview = append(item.Preview, "Started     "+task.StartedAt.Local().Format(time.RFC1123))
+	}
+	item.Preview = append(item.Preview, "Containers")
+	for _, container := range task.Containers {
+		item.Fields = append(item.Fields, aws.ToString(container.Name))
+		item.Preview = append(item.Preview, fmt.Sprintf("  %s (%s)", aws.ToString(container.Name), aws.ToString(container.LastStatus)))
+	}
+	return item
 }
 
-func ecsConnect(c *internal.Client) {
-	clusterArn := getClusters(c)
-	task := strings.Split(getTasks(c, clusterArn), " : ")[1]
+func ecsConnect(clients []*internal.Client) {
+	clusterArn, c := getClusters(clients)
+	task := getTasks(c, clusterArn)
+	execTask(c, clusterArn, task)
+}
+
+func execTask(c *internal.Client, clusterArn string, task string) {
 	fmt.Println(aurora.Bold(aurora.BrightGreen("Connecting to")), aurora.BrightCyan(task))
+	recordTask(c, clusterArn, task)
 
 	arg0 := "aws"
 	arg1 := "ecs"
@@ -134,10 +193,9 @@ func ecsConnect(c *internal.Client) {
 	arg4 := "--cluster=" + clusterArn
 	arg5 := "--command=/bin/bash"
 	arg6 := "--interactive"
-	arg7 := "--region=" + c.Region
-	arg8 := "--profile=" + c.Profile
+	args := append([]string{arg1, arg2, arg3, arg4, arg5, arg6}, c.CLIArgs()...)
 
-	if err := internal.RunCommand(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8); err != nil {
+	if err := c.RunSession(task, "ecs execute-command", true, arg0, args...); err != nil {
 		return
 	}
 
@@ -147,4 +205,6 @@ func ecsConnect(c *internal.Client) {
 
 func init() {
 	connectCmd.AddCommand(ecsCmd)
+
+	ecsCmd.Flags().BoolVar(&ecsDiagnose, "diagnose", false, "Check why a task can't be connected to, instead of connecting")
 }
@@ -0,0 +1,33 @@
+package connect
+
+import (
+	"fmt"
+
+	internal "github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+// lastCmd represents the last command
+var lastCmd = &cobra.Command{
+	Use:   "last",
+	Short: "Reconnect to the most recent target",
+	Long: `Reconnect to the instance or task used by the most recent connect ec2
+or connect ecs, with the same profile and region. If it has since been
+replaced, an instance with the same Name tag or a task from the same
+service is used instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		t, err := internal.LastTarget()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			return
+		}
+		if err := connectTarget(t, true); err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+		}
+	},
+}
+
+func init() {
+	connectCmd.AddCommand(lastCmd)
+}
@@ -0,0 +1,174 @@
+package connect
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	internal "github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/viper"
+)
+
+// sessionSettings chooses the document a connect ec2 session starts and
+// who it logs in as. They come from, in increasing priority: the built in
+// platform defaults, then the sessions section of the config file by
+// platform, profile and tag, then flags.
+//
+//	sessions:
+//	  platforms:
+//	    amazon-linux: {user: ec2-user}
+//	    windows: {document: SSM-SessionManagerRunShell}
+//	  profiles:
+//	    prod: {user: admin}
+//	  tags:
+//	    - match: {Role: bastion}
+//	      document: AWS-StartInteractiveCommand
+//	      parameters: 'command=["bash -l"]'
+type sessionSettings struct {
+	Document   string `mapstructure:"document"`
+	Parameters string `mapstructure:"parameters"`
+	User       string `mapstructure:"user"`
+}
+
+type tagSessionSettings struct {
+	Match           map[string]string `mapstructure:"match"`
+	sessionSettings `mapstructure:",squash"`
+}
+
+type sessionsConfig struct {
+	Platforms map[string]sessionSettings `mapstructure:"platforms"`
+	Profiles  map[string]sessionSettings `mapstructure:"profiles"`
+	Tags      []tagSessionSettings       `mapstructure:"tags"`
+}
+
+const (
+	// standardSessionDocument is the document used when start-session is
+	// given none, giving a plain shell or PowerShell as the ssm-user.
+	standardSessionDocument    = "SSM-SessionManagerRunShell"
+	interactiveCommandDocument = "AWS-StartInteractiveCommand"
+)
+
+// sessionFlags holds the connect ec2 --document, --parameters and --user
+// flags.
+var sessionFlags sessionSettings
+
+// platformDefaults are used when the config file doesn't say otherwise.
+// Windows has no sudo so gets the standard PowerShell session.
+var platformDefaults = map[string]sessionSettings{
+	"windows":      {Document: standardSessionDocument},
+	"amazon-linux": {Document: interactiveCommandDocument, User: "ec2-user"},
+	"linux":        {Document: interactiveCommandDocument, User: "root"},
+}
+
+// merge applies the non-empty settings in o over s. Choosing a different
+// document discards parameters meant for the previous one, and choosing a
+// user replaces any parameters not set alongside it.
+func (s sessionSettings) merge(o sessionSettings) sessionSettings {
+	if o.Document != "" && o.Document != s.Document {
+		s = sessionSettings{Document: o.Document}
+	}
+	if o.User != "" {
+		s.User = o.User
+		s.Parameters = ""
+	}
+	if o.Parameters != "" {
+		s.Parameters = o.Parameters
+	}
+	return s
+}
+
+// document returns the session document that will be started.
+func (s sessionSettings) document() string {
+	if s.Document == "" {
+		return standardSessionDocument
+	}
+	return s.Document
+}
+
+// args returns the start-session arguments for the settings.
+func (s sessionSettings) args() []string {
+	args := []string{}
+	if s.Document != "" && s.Document != standardSessionDocument {
+		args = append(args, "--document-name="+s.Document)
+	}
+
+	switch {
+	case s.Parameters != "":
+		args = append(args, "--parameters="+s.Parameters)
+	case s.User != "" && s.Document == interactiveCommandDocument:
+		params, _ := json.Marshal(map[string][]string{"command": {"sudo -iu " + s.User}})
+		args = append(args, "--parameters="+string(params))
+	case s.User != "":
+		fmt.Fprintln(os.Stderr, aurora.BrightYellow(fmt.Sprintf("Ignoring user %s, the %s document can't change user", s.User, s.Document)))
+	}
+	return args
+}
+
+// platformKey maps the platform the SSM agent reports to a key in the
+// platforms config.
+func platformKey(info *ssmtypes.InstanceInformation) string {
+	if info == nil {
+		return "linux"
+	}
+	switch {
+	case info.PlatformType == ssmtypes.PlatformTypeWindows:
+		return "windows"
+	case info.PlatformType == ssmtypes.PlatformTypeMacos:
+		return "macos"
+	case strings.Contains(aws.ToString(info.PlatformName), "Amazon Linux"):
+		return "amazon-linux"
+	default:
+		return "linux"
+	}
+}
+
+// resolveSessionSettings works out the session settings for an instance.
+func resolveSessionSettings(c *internal.Client, info *ssmtypes.InstanceInformation, instance *ec2types.Instance) sessionSettings {
+	config := sessionsConfig{}
+	if err := viper.UnmarshalKey("sessions", &config); err != nil {
+		fmt.Println(aurora.BrightYellow("Ignoring invalid sessions config: " + err.Error()))
+	}
+
+	platform := platformKey(info)
+	settings := platformDefaults["linux"]
+	if defaults, ok := platformDefaults[platform]; ok {
+		settings = defaults
+	}
+	settings = settings.merge(config.Platforms[platform])
+
+	// Viper lower cases map keys, so profiles and tag keys match regardless
+	// of case.
+	settings = settings.merge(config.Profiles[strings.ToLower(c.Profile)])
+
+	if instance != nil {
+		tags := map[string]string{}
+		for _, tag := range instance.Tags {
+			tags[strings.ToLower(aws.ToString(tag.Key))] = aws.ToString(tag.Value)
+		}
+		for _, rule := range config.Tags {
+			if matchTags(rule.Match, tags) {
+				settings = settings.merge(rule.sessionSettings)
+				break
+			}
+		}
+	}
+
+	return settings.merge(sessionFlags)
+}
+
+func matchTags(match map[string]string, tags map[string]string) bool {
+	if len(match) == 0 {
+		return false
+	}
+	for k, v := range match {
+		if value, ok := tags[strings.ToLower(k)]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
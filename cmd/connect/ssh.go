@@ -0,0 +1,168 @@
+package connect
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	internal "github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var sshPort int
+var sshUser string
+var sshPrefix string
+
+// sshProxyCmd represents the ssh-proxy command
+var sshProxyCmd = &cobra.Command{
+	Use:   "ssh-proxy <instance-id-or-name>",
+	Short: "Tunnel SSH to an instance over SSM, for use as a ProxyCommand",
+	Long: `Open an AWS-StartSSHSession session to an instance and connect it to
+stdin and stdout, so ssh, scp, rsync and editors using SSH can reach
+instances with no inbound access. Add it to ~/.ssh/config with:
+
+  Host i-* mi-*
+      ProxyCommand awsclihelper connect ssh-proxy %h --port %p
+
+Instances can be given by ID or by Name tag. A Name tag matching several
+instances uses the first one that is online.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Stdout belongs to ssh, so everything else goes to stderr.
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		instanceID := args[0]
+		if !isInstanceID(instanceID) {
+			t := internal.Target{Kind: "ec2", Label: args[0], Tags: map[string]string{"Name": args[0]}}
+			if instanceID, err = resolveInstance(c, t, false); err != nil {
+				// Instances without a Name tag are listed under their host name.
+				instanceID = ""
+				for _, instance := range getManagedInstances(c) {
+					if instance.Fields[0] == args[0] {
+						instanceID = instance.ID
+						break
+					}
+				}
+				if instanceID == "" {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+		}
+
+		sessionArgs := append([]string{
+			"ssm", "start-session",
+			"--target=" + instanceID,
+			"--document-name=AWS-StartSSHSession",
+			fmt.Sprintf("--parameters=portNumber=%d", sshPort),
+		}, c.CLIArgs()...)
+		// The session carries the SSH protocol, so it's audited but never
+		// recorded.
+		if err := c.RunSession(instanceID, "AWS-StartSSHSession", false, "aws", sessionArgs...); err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+// sshConfigCmd represents the ssh-config command
+var sshConfigCmd = &cobra.Command{
+	Use:   "ssh-config",
+	Short: "Print ssh config Host blocks for all managed instances",
+	Long: `Print a Host block for every SSM managed instance, named after its
+Name tag and using ssh-proxy as the ProxyCommand. Append the output to
+~/.ssh/config, or save it to a file and Include it:
+
+  awsclihelper connect ssh-config --profile prod > ~/.ssh/config.d/prod
+
+Instances sharing a Name tag get the instance ID appended to keep each
+Host unique.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clients, err := internal.NewClients()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			executable = "awsclihelper"
+		}
+		printSSHConfig(clients, executable)
+	},
+}
+
+var instanceIDPattern = regexp.MustCompile(`^m?i-[0-9a-f]+$`)
+
+func isInstanceID(s string) bool {
+	return instanceIDPattern.MatchString(s)
+}
+
+type sshHost struct {
+	alias    string
+	hostName string
+	client   *internal.Client
+}
+
+func printSSHConfig(clients []*internal.Client, executable string) {
+	hosts := []sshHost{}
+	for _, c := range clients {
+		instances := getManagedInstances(c)
+
+		counts := map[string]int{}
+		for _, instance := range instances {
+			counts[instance.Fields[0]]++
+		}
+
+		for _, instance := range instances {
+			alias := sshPrefix + sanitiseHost(instance.Fields[0])
+			// Unique names resolve through the Name tag when connecting, so
+			// the entry keeps working after the instance is replaced.
+			hostName := instance.Fields[0]
+			if counts[instance.Fields[0]] > 1 || hostName != sanitiseHost(hostName) {
+				hostName = instance.ID
+			}
+			if counts[instance.Fields[0]] > 1 {
+				alias += "-" + instance.ID
+			}
+			if len(clients) > 1 {
+				alias += "." + c.Region
+			}
+			hosts = append(hosts, sshHost{alias: alias, hostName: hostName, client: c})
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].alias < hosts[j].alias })
+
+	for _, h := range hosts {
+		proxy := []string{executable, "connect", "ssh-proxy", "%h", "--port", "%p"}
+		proxy = append(proxy, h.client.Flags()...)
+
+		fmt.Printf("Host %s\n", h.alias)
+		fmt.Printf("    HostName %s\n", h.hostName)
+		if sshUser != "" {
+			fmt.Printf("    User %s\n", sshUser)
+		}
+		fmt.Printf("    ProxyCommand %s\n\n", strings.Join(proxy, " "))
+	}
+}
+
+var unsafeHostChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func sanitiseHost(name string) string {
+	return strings.Trim(unsafeHostChars.ReplaceAllString(name, "-"), "-")
+}
+
+func init() {
+	connectCmd.AddCommand(sshProxyCmd)
+	connectCmd.AddCommand(sshConfigCmd)
+
+	sshProxyCmd.Flags().IntVar(&sshPort, "port", 22, "SSH port on the instance")
+	sshConfigCmd.Flags().StringVarP(&sshUser, "user", "u", "", "User to add to each Host block")
+	sshConfigCmd.Flags().StringVar(&sshPrefix, "prefix", "", "Prefix for each Host alias, e.g. prod-")
+}
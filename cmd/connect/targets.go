@@ -0,0 +1,212 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	internal "github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/viper"
+)
+
+// recordInstance adds an instance to the connection history along with its
+// Name tag, so bookmarks made from it can find a replacement instance.
+func recordInstance(c *internal.Client, instanceID string, label string, instance *ec2types.Instance) {
+	t := internal.Target{
+		Kind:    "ec2",
+		ID:      instanceID,
+		Label:   label,
+		Tags:    map[string]string{},
+		Profile: c.Profile,
+		Region:  c.Region,
+	}
+
+	if instance != nil {
+		for _, tag := range instance.Tags {
+			if aws.ToString(tag.Key) == "Name" {
+				t.Tags["Name"] = aws.ToString(tag.Value)
+			}
+		}
+	}
+
+	if err := internal.RecordTarget(t); err != nil {
+		fmt.Println(aurora.BrightYellow("Unable to record connection history: " + err.Error()))
+	}
+}
+
+// recordTask adds a task to the connection history along with its task
+// group, so bookmarks made from it can find a replacement task.
+func recordTask(c *internal.Client, clusterArn string, taskArn string) {
+	t := internal.Target{
+		Kind:    "ecs",
+		ID:      taskArn,
+		Label:   internal.ShortArn(taskArn),
+		Cluster: clusterArn,
+		Profile: c.Profile,
+		Region:  c.Region,
+	}
+
+	output, err := c.ECS.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
+		Cluster: aws.String(clusterArn),
+		Tasks:   []string{taskArn},
+	})
+	if err == nil && len(output.Tasks) == 1 {
+		t.Group = aws.ToString(output.Tasks[0].Group)
+		t.Label = t.Group + " : " + t.Label
+	}
+
+	if err := internal.RecordTarget(t); err != nil {
+		fmt.Println(aurora.BrightYellow("Unable to record connection history: " + err.Error()))
+	}
+}
+
+// connectTarget reconnects to a remembered target using the profile and
+// region it was recorded with. When byID is set the recorded instance or
+// task is preferred if it's still available.
+func connectTarget(t internal.Target, byID bool) error {
+	viper.Set("profile", t.Profile)
+	viper.Set("region", t.Region)
+	c, err := internal.NewClient()
+	if err != nil {
+		return err
+	}
+	c.CmdHeader()
+
+	switch t.Kind {
+	case "ec2":
+		instanceID, err := resolveInstance(c, t, byID)
+		if err != nil {
+			return err
+		}
+		startSession(c, instanceID, t.Label)
+	case "ecs":
+		taskArn, err := resolveTask(c, t, byID)
+		if err != nil {
+			return err
+		}
+		execTask(c, t.Cluster, taskArn)
+	default:
+		return fmt.Errorf("unknown target kind %q", t.Kind)
+	}
+	return nil
+}
+
+// resolveInstance finds an online managed instance for a target, matching
+// on its recorded tags.
+func resolveInstance(c *internal.Client, t internal.Target, byID bool) (string, error) {
+	candidates := []string{}
+	if byID {
+		candidates = append(candidates, t.ID)
+	}
+
+	if len(t.Tags) > 0 {
+		filters := []ec2types.Filter{{
+			Name:   aws.String("instance-state-name"),
+			Values: []string{"running"},
+		}}
+		for k, v := range t.Tags {
+			filters = append(filters, ec2types.Filter{Name: aws.String("tag:" + k), Values: []string{v}})
+		}
+		output, err := c.EC2.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{Filters: filters})
+		if err != nil {
+			return "", err
+		}
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				candidates = append(candidates, aws.ToString(instance.InstanceId))
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no running instances match %s", t.Label)
+	}
+
+	output, err := c.SSM.DescribeInstanceInformation(context.TODO(), &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{{
+			Key:    aws.String("InstanceIds"),
+			Values: candidates,
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+	online := map[string]bool{}
+	for _, info := range output.InstanceInformationList {
+		if info.PingStatus == ssmtypes.PingStatusOnline {
+			online[aws.ToString(info.InstanceId)] = true
+		}
+	}
+	for _, id := range candidates {
+		if online[id] {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no online managed instances match %s", t.Label)
+}
+
+// resolveTask finds a running task for a target, falling back to any
+// running task in the same task group.
+func resolveTask(c *internal.Client, t internal.Target, byID bool) (string, error) {
+	if byID {
+		output, err := c.ECS.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
+			Cluster: aws.String(t.Cluster),
+			Tasks:   []string{t.ID},
+		})
+		if err == nil && len(output.Tasks) == 1 && aws.ToString(output.Tasks[0].LastStatus) == "RUNNING" {
+			return t.ID, nil
+		}
+	}
+
+	input := &ecs.ListTasksInput{
+		Cluster:       aws.String(t.Cluster),
+		DesiredStatus: ecstypes.DesiredStatusRunning,
+	}
+	switch {
+	case strings.HasPrefix(t.Group, "service:"):
+		input.ServiceName = aws.String(strings.TrimPrefix(t.Group, "service:"))
+	case strings.HasPrefix(t.Group, "family:"):
+		input.Family = aws.String(strings.TrimPrefix(t.Group, "family:"))
+	default:
+		return "", fmt.Errorf("task %s is no longer running", t.Label)
+	}
+
+	output, err := c.ECS.ListTasks(context.TODO(), input)
+	if err != nil {
+		return "", err
+	}
+	if len(output.TaskArns) == 0 {
+		return "", fmt.Errorf("no running tasks in %s", t.Group)
+	}
+	return output.TaskArns[0], nil
+}
+
+// findInstance returns the managed instance whose ID or Name tag is query,
+// showing the picker when query is empty or matches more than one instance.
+func findInstance(clients []*internal.Client, query string) (internal.Item, error) {
+	instances := internal.Labelled(clients, getManagedInstances)
+
+	if query != "" {
+		matches := []internal.Item{}
+		for _, instance := range instances {
+			if instance.ID == query || instance.Fields[0] == query {
+				matches = append(matches, instance)
+			}
+		}
+		if len(matches) == 1 {
+			return matches[0], nil
+		} else if len(matches) == 0 {
+			return internal.Item{}, fmt.Errorf("no managed instance matches %s", query)
+		}
+		instances = matches
+	}
+
+	return internal.Pick("Choose an instance:", "ec2", instances)
+}
@@ -0,0 +1,211 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	internal "github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var tunnelPort int
+var tunnelLocalPort int
+var tunnelHost string
+var tunnelContainer string
+
+const (
+	portForwardingDocument       = "AWS-StartPortForwardingSession"
+	remotePortForwardingDocument = "AWS-StartPortForwardingSessionToRemoteHost"
+)
+
+// ecsTunnelCmd represents the ecs-tunnel command
+var ecsTunnelCmd = &cobra.Command{
+	Use:   "ecs-tunnel",
+	Short: "Forward a local port to an ECS task, or through it to another host",
+	Long: `Start an SSM port forwarding session to a container in an ECS task, so
+a port on the container can be reached on localhost. The task must have
+execute command enabled.
+
+Without --port the port is chosen from the container's port mappings in
+the task definition. The local port defaults to the remote port.
+
+With --host the task is used as a jump host instead, for reaching things
+only the task's network can, such as an RDS database:
+
+  awsclihelper connect ecs-tunnel --host mydb.abc123.eu-west-1.rds.amazonaws.com --port 5432 --local-port 15432`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if tunnelHost != "" && tunnelPort == 0 {
+			fmt.Println(aurora.Bold(aurora.BrightRed("--port is required with --host")))
+			os.Exit(1)
+		}
+
+		clients, err := internal.NewClients()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		internal.RegionHeader(clients)
+
+		clusterArn, c := getClusters(clients)
+		taskArn := getTasks(c, clusterArn)
+		if err := tunnel(c, clusterArn, taskArn); err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+	},
+}
+
+func tunnel(c *internal.Client, clusterArn string, taskArn string) error {
+	output, err := c.ECS.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
+		Cluster: aws.String(clusterArn),
+		Tasks:   []string{taskArn},
+	})
+	if err != nil {
+		return err
+	}
+	if len(output.Tasks) == 0 {
+		return fmt.Errorf("task %s not found", taskArn)
+	}
+	task := output.Tasks[0]
+
+	container, err := chooseContainer(task)
+	if err != nil {
+		return err
+	}
+	if container.RuntimeId == nil {
+		return fmt.Errorf("container %s has no runtime ID yet, is it running?", aws.ToString(container.Name))
+	}
+
+	port := tunnelPort
+	if port == 0 {
+		if port, err = choosePort(c, task, aws.ToString(container.Name)); err != nil {
+			return err
+		}
+	}
+	localPort := tunnelLocalPort
+	if localPort == 0 {
+		localPort = port
+	}
+
+	// Session Manager addresses containers as ecs:<cluster>_<task>_<runtime ID>.
+	target := fmt.Sprintf("ecs:%s_%s_%s", internal.ShortArn(clusterArn), internal.ShortArn(taskArn), aws.ToString(container.RuntimeId))
+
+	document := portForwardingDocument
+	parameters := map[string][]string{
+		"portNumber":      {strconv.Itoa(port)},
+		"localPortNumber": {strconv.Itoa(localPort)},
+	}
+	destination := fmt.Sprintf("%s:%d", aws.ToString(container.Name), port)
+	if tunnelHost != "" {
+		document = remotePortForwardingDocument
+		parameters["host"] = []string{tunnelHost}
+		destination = fmt.Sprintf("%s:%d", tunnelHost, port)
+	}
+	params, _ := json.Marshal(parameters)
+
+	fmt.Println(aurora.Bold(aurora.BrightGreen("Forwarding")), aurora.BrightCyan(fmt.Sprintf("localhost:%d", localPort)),
+		aurora.Bold(aurora.BrightGreen("to")), aurora.BrightCyan(destination), aurora.Bold(aurora.BrightGreen("via")), aurora.BrightCyan(internal.ShortArn(taskArn)))
+
+	args := append([]string{
+		"ssm", "start-session",
+		"--target=" + target,
+		"--document-name=" + document,
+		"--parameters=" + string(params),
+	}, c.CLIArgs()...)
+	// Tunnels carry arbitrary protocols, so they're audited but never
+	// recorded.
+	return c.RunSession(target, document, false, "aws", args...)
+}
+
+// chooseContainer returns the --container container, the only container,
+// or asks which one to use.
+func chooseContainer(task types.Task) (types.Container, error) {
+	items := []internal.Item{}
+	byName := map[string]types.Container{}
+	for _, container := range task.Containers {
+		name := aws.ToString(container.Name)
+		if tunnelContainer != "" && name == tunnelContainer {
+			return container, nil
+		}
+		byName[name] = container
+		items = append(items, internal.Item{
+			ID:      name,
+			Label:   name,
+			Preview: []string{"Container  " + name, "Image      " + aws.ToString(container.Image), "Status     " + aws.ToString(container.LastStatus)},
+		})
+	}
+
+	if tunnelContainer != "" {
+		return types.Container{}, fmt.Errorf("task has no container named %s", tunnelContainer)
+	}
+	if len(items) == 0 {
+		return types.Container{}, errors.New("task has no containers")
+	} else if len(items) == 1 {
+		return task.Containers[0], nil
+	}
+	choice, err := internal.Pick("Which container?:", "ecs-container", items)
+	if err != nil {
+		return types.Container{}, err
+	}
+	return byName[choice.ID], nil
+}
+
+// choosePort offers the container's port mappings from its task definition.
+func choosePort(c *internal.Client, task types.Task, containerName string) (int, error) {
+	output, err := c.ECS.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: task.TaskDefinitionArn,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if output.TaskDefinition == nil {
+		return 0, fmt.Errorf("task definition %s not found", aws.ToString(task.TaskDefinitionArn))
+	}
+
+	items := []internal.Item{}
+	for _, definition := range output.TaskDefinition.ContainerDefinitions {
+		if aws.ToString(definition.Name) != containerName {
+			continue
+		}
+		for _, mapping := range definition.PortMappings {
+			if mapping.ContainerPort == nil {
+				continue
+			}
+			port := strconv.Itoa(int(*mapping.ContainerPort))
+			label := port + "/" + string(mapping.Protocol)
+			if mapping.Protocol == "" {
+				label = port + "/tcp"
+			}
+			items = append(items, internal.Item{ID: port, Label: label})
+		}
+	}
+
+	if len(items) == 0 {
+		return 0, fmt.Errorf("container %s has no port mappings, choose a port with --port", containerName)
+	} else if len(items) == 1 {
+		return strconv.Atoi(items[0].ID)
+	}
+	choice, err := internal.Pick("Which port?:", "ecs-port", items)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(choice.ID)
+}
+
+func init() {
+	connectCmd.AddCommand(ecsTunnelCmd)
+
+	ecsTunnelCmd.Flags().IntVar(&tunnelPort, "port", 0, "Remote port, by default chosen from the container's port mappings")
+	ecsTunnelCmd.Flags().IntVarP(&tunnelLocalPort, "local-port", "l", 0, "Local port to listen on (default the remote port)")
+	ecsTunnelCmd.Flags().StringVar(&tunnelHost, "host", "", "Remote host to reach through the task, e.g. an RDS endpoint")
+	ecsTunnelCmd.Flags().StringVar(&tunnelContainer, "container", "", "Container in the task to forward to")
+}
@@ -0,0 +1,250 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/jjkirkpatrick/awsclihelper/cmd"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+// ec2Cmd represents the ec2 command
+var ec2Cmd = &cobra.Command{
+	Use:   "ec2",
+	Short: "List, start, stop and reboot EC2 instances",
+	Long: `List EC2 instances and change their state.
+
+Instances are given as arguments by instance ID or Name tag, or with
+--targets as a comma separated list of instance IDs and tag:Key=Value
+filters, as with the run command. Without either they are chosen from a
+list.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// instance is an EC2 instance along with the client it was found with.
+type instance struct {
+	types.Instance
+	client *internal.Client
+}
+
+func (i instance) id() string {
+	return aws.ToString(i.InstanceId)
+}
+
+func (i instance) name() string {
+	for _, tag := range i.Tags {
+		if aws.ToString(tag.Key) == "Name" {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+func (i instance) state() types.InstanceStateName {
+	if i.State == nil {
+		return ""
+	}
+	return i.State.Name
+}
+
+func (i instance) tag(key string) string {
+	for _, tag := range i.Tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+// label names an instance in messages.
+func (i instance) label() string {
+	if name := i.name(); name != "" {
+		return i.id() + " : " + name
+	}
+	return i.id()
+}
+
+func (i instance) item(multiRegion bool) internal.Item {
+	launched := ""
+	if i.LaunchTime != nil {
+		launched = i.LaunchTime.Local().Format("2006-01-02 15:04")
+	}
+	label := fmt.Sprintf("%s  %s  %s  %s", i.label(), i.state(), i.InstanceType, aws.ToString(i.PrivateIpAddress))
+	if multiRegion {
+		label = fmt.Sprintf("[%s] %s", i.client.Region, label)
+	}
+
+	preview := []string{
+		"Instance    " + i.id(),
+		"State       " + string(i.state()),
+		"Type        " + string(i.InstanceType),
+		"Private IP  " + aws.ToString(i.PrivateIpAddress),
+		"Public IP   " + aws.ToString(i.PublicIpAddress),
+		"Launched    " + launched,
+	}
+	tags := []string{}
+	for _, tag := range i.Tags {
+		tags = append(tags, fmt.Sprintf("  %s = %s", aws.ToString(tag.Key), aws.ToString(tag.Value)))
+	}
+	if len(tags) > 0 {
+		sort.Strings(tags)
+		preview = append(preview, "", "Tags")
+		preview = append(preview, tags...)
+	}
+
+	return internal.Item{
+		ID:      i.id(),
+		Label:   label,
+		Fields:  []string{i.name()},
+		Preview: preview,
+		Client:  i.client,
+	}
+}
+
+var instanceIDPattern = regexp.MustCompile(`^i-[0-9a-f]+$`)
+
+// targetFilters turns instance IDs or Name tags given as arguments, and a
+// --targets spec, into sets of DescribeInstances filters. Each set is
+// queried separately and the results combined.
+func targetFilters(args []string, spec string) ([][]types.Filter, error) {
+	base := []types.Filter{}
+	ids := []string{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+		case strings.HasPrefix(part, "tag:"):
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("target %s must be tag:Key=Value", part)
+			}
+			base = append(base, types.Filter{Name: aws.String(kv[0]), Values: []string{kv[1]}})
+		default:
+			ids = append(ids, part)
+		}
+	}
+	if len(ids) > 0 {
+		base = append(base, types.Filter{Name: aws.String("instance-id"), Values: ids})
+	}
+	if len(args) == 0 {
+		return [][]types.Filter{base}, nil
+	}
+
+	argIDs := []string{}
+	names := []string{}
+	for _, arg := range args {
+		if instanceIDPattern.MatchString(arg) {
+			argIDs = append(argIDs, arg)
+		} else {
+			names = append(names, arg)
+		}
+	}
+	sets := [][]types.Filter{}
+	if len(argIDs) > 0 {
+		sets = append(sets, append(append([]types.Filter{}, base...), types.Filter{Name: aws.String("instance-id"), Values: argIDs}))
+	}
+	if len(names) > 0 {
+		sets = append(sets, append(append([]types.Filter{}, base...), types.Filter{Name: aws.String("tag:Name"), Values: names}))
+	}
+	return sets, nil
+}
+
+// listInstances finds the instances matching any of the filter sets in
+// every region, sorted by name.
+func listInstances(clients []*internal.Client, sets [][]types.Filter) ([]instance, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := map[string]bool{}
+	instances := []instance{}
+	errs := []error{}
+
+	for _, client := range clients {
+		wg.Add(1)
+		go func(c *internal.Client) {
+			defer wg.Done()
+			for _, filters := range sets {
+				found, err := describeInstances(c, filters)
+
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", c.Region, err))
+				}
+				for _, i := range found {
+					if !seen[i.id()] {
+						seen[i.id()] = true
+						instances = append(instances, i)
+					}
+				}
+				mu.Unlock()
+			}
+		}(client)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		fmt.Println(aurora.BrightRed(err))
+	}
+	if len(instances) == 0 && len(errs) > 0 {
+		return nil, errors.New("unable to list instances")
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].name() != instances[j].name() {
+			return instances[i].name() < instances[j].name()
+		}
+		return instances[i].id() < instances[j].id()
+	})
+	return instances, nil
+}
+
+func describeInstances(c *internal.Client, filters []types.Filter) ([]instance, error) {
+	instances := []instance{}
+	paginator := ec2.NewDescribeInstancesPaginator(c.EC2, &ec2.DescribeInstancesInput{Filters: filters})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range output.Reservations {
+			for _, i := range reservation.Instances {
+				instances = append(instances, instance{Instance: i, client: c})
+			}
+		}
+	}
+	return instances, nil
+}
+
+// stateColour colours an instance state by whether it's settled.
+func stateColour(state types.InstanceStateName, s string) aurora.Value {
+	switch state {
+	case types.InstanceStateNameRunning:
+		return aurora.BrightGreen(s)
+	case types.InstanceStateNameStopped:
+		return aurora.BrightRed(s)
+	case types.InstanceStateNameTerminated, types.InstanceStateNameShuttingDown:
+		return aurora.Faint(s)
+	default:
+		return aurora.BrightYellow(s)
+	}
+}
+
+// elapsed formats a wait duration for progress messages.
+func elapsed(start time.Time) string {
+	return time.Since(start).Round(time.Second).String()
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(ec2Cmd)
+}
@@ -0,0 +1,262 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+// lifecycleAction describes one of the start, stop and reboot commands.
+type lifecycleAction struct {
+	verb    string
+	doing   string
+	done    string
+	states  []types.InstanceStateName
+	perform func(ctx context.Context, c *internal.Client, ids []string) error
+	wait    func(ctx context.Context, c *internal.Client, ids []string, timeout time.Duration) error
+}
+
+var lifecycleTargets string
+var lifecycleYes bool
+var lifecycleNoWait bool
+var lifecycleTimeout time.Duration
+var stopForce bool
+
+var startAction = lifecycleAction{
+	verb:   "start",
+	doing:  "Starting",
+	done:   "running",
+	states: []types.InstanceStateName{types.InstanceStateNameStopped},
+	perform: func(ctx context.Context, c *internal.Client, ids []string) error {
+		_, err := c.EC2.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: ids})
+		return err
+	},
+	wait: func(ctx context.Context, c *internal.Client, ids []string, timeout time.Duration) error {
+		return ec2.NewInstanceRunningWaiter(c.EC2).Wait(ctx, &ec2.DescribeInstancesInput{InstanceIds: ids}, timeout)
+	},
+}
+
+var stopAction = lifecycleAction{
+	verb:   "stop",
+	doing:  "Stopping",
+	done:   "stopped",
+	states: []types.InstanceStateName{types.InstanceStateNameRunning, types.InstanceStateNamePending},
+	perform: func(ctx context.Context, c *internal.Client, ids []string) error {
+		_, err := c.EC2.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: ids, Force: aws.Bool(stopForce)})
+		return err
+	},
+	wait: func(ctx context.Context, c *internal.Client, ids []string, timeout time.Duration) error {
+		return ec2.NewInstanceStoppedWaiter(c.EC2).Wait(ctx, &ec2.DescribeInstancesInput{InstanceIds: ids}, timeout)
+	},
+}
+
+// Rebooted instances stay running throughout, so the reboot waiter waits
+// for their status checks to pass instead.
+var rebootAction = lifecycleAction{
+	verb:   "reboot",
+	doing:  "Rebooting",
+	done:   "passing status checks",
+	states: []types.InstanceStateName{types.InstanceStateNameRunning},
+	perform: func(ctx context.Context, c *internal.Client, ids []string) error {
+		_, err := c.EC2.RebootInstances(ctx, &ec2.RebootInstancesInput{InstanceIds: ids})
+		return err
+	},
+	wait: func(ctx context.Context, c *internal.Client, ids []string, timeout time.Duration) error {
+		// Status checks can report the state from before the reboot for a
+		// short while.
+		select {
+		case <-time.After(30 * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return ec2.NewInstanceStatusOkWaiter(c.EC2).Wait(ctx, &ec2.DescribeInstanceStatusInput{InstanceIds: ids}, timeout)
+	},
+}
+
+func newLifecycleCmd(action lifecycleAction, short string, long string) *cobra.Command {
+	command := &cobra.Command{
+		Use:   action.verb + " [instance-id-or-name...]",
+		Short: short,
+		Long:  long,
+		Run: func(cmd *cobra.Command, args []string) {
+			clients, err := internal.NewClients()
+			if err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(1)
+			}
+			internal.RegionHeader(clients)
+
+			instances, err := selectInstances(clients, action, args, lifecycleTargets)
+			if err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(1)
+			}
+			if !lifecycleYes && !confirmAction(action, instances) {
+				os.Exit(1)
+			}
+			if !runAction(action, instances) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	command.Flags().StringVarP(&lifecycleTargets, "targets", "t", "", "Instance IDs and tag:Key=Value filters, comma separated")
+	command.Flags().BoolVarP(&lifecycleYes, "yes", "y", false, "Don't ask for confirmation")
+	command.Flags().BoolVar(&lifecycleNoWait, "no-wait", false, "Return without waiting for the instances to change state")
+	command.Flags().DurationVar(&lifecycleTimeout, "timeout", 10*time.Minute, "Maximum time to wait for the instances to change state")
+	return command
+}
+
+// selectInstances finds the instances to act on. Matched instances already
+// in the target state are reported and skipped.
+func selectInstances(clients []*internal.Client, action lifecycleAction, args []string, spec string) ([]instance, error) {
+	sets, err := targetFilters(args, spec)
+	if err != nil {
+		return nil, err
+	}
+	interactive := len(args) == 0 && spec == ""
+	if interactive {
+		states := []string{}
+		for _, state := range action.states {
+			states = append(states, string(state))
+		}
+		sets[0] = append(sets[0], types.Filter{Name: aws.String("instance-state-name"), Values: states})
+	}
+
+	found, err := listInstances(clients, sets)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []instance{}
+	for _, i := range found {
+		if hasState(action.states, i.state()) {
+			instances = append(instances, i)
+		} else {
+			fmt.Println(aurora.BrightYellow(fmt.Sprintf("Skipping %s, it is %s", i.label(), i.state())))
+		}
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no instances to %s", action.verb)
+	}
+	if !interactive {
+		return instances, nil
+	}
+
+	items := []internal.Item{}
+	byID := map[string]instance{}
+	for _, i := range instances {
+		items = append(items, i.item(len(clients) > 1))
+		byID[i.id()] = i
+	}
+	chosen, err := internal.PickMany(fmt.Sprintf("Choose instances to %s:", action.verb), "ec2", items)
+	if err != nil {
+		return nil, err
+	}
+	instances = []instance{}
+	for _, item := range chosen {
+		instances = append(instances, byID[item.ID])
+	}
+	return instances, nil
+}
+
+func hasState(states []types.InstanceStateName, state types.InstanceStateName) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func confirmAction(action lifecycleAction, instances []instance) bool {
+	fmt.Println(aurora.Bold(fmt.Sprintf("About to %s:", action.verb)))
+	for _, i := range instances {
+		fmt.Println("  ", aurora.BrightCyan(i.label()), aurora.Faint(i.client.Region))
+	}
+
+	confirmation := false
+	prompt := &survey.Confirm{
+		Message: fmt.Sprintf("%s %d instance(s)?", strings.Title(action.verb), len(instances)),
+	}
+	survey.AskOne(prompt, &confirmation)
+	return confirmation
+}
+
+// runAction performs the action region by region and, unless --no-wait is
+// set, waits for every instance to reach the target state. It returns
+// false if any region failed.
+func runAction(action lifecycleAction, instances []instance) bool {
+	byClient := map[*internal.Client][]string{}
+	for _, i := range instances {
+		byClient[i.client] = append(byClient[i.client], i.id())
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ok := true
+	start := time.Now()
+
+	for client, ids := range byClient {
+		wg.Add(1)
+		go func(c *internal.Client, ids []string) {
+			defer wg.Done()
+			ctx := context.TODO()
+			err := action.perform(ctx, c, ids)
+
+			mu.Lock()
+			if err != nil {
+				ok = false
+				fmt.Println(aurora.BrightRed(fmt.Sprintf("%s: unable to %s %s: %s", c.Region, action.verb, strings.Join(ids, ", "), err)))
+				mu.Unlock()
+				return
+			}
+			fmt.Println(aurora.BrightGreen(action.doing), aurora.BrightCyan(strings.Join(ids, ", ")))
+			mu.Unlock()
+
+			if lifecycleNoWait {
+				return
+			}
+			err = action.wait(ctx, c, ids, lifecycleTimeout)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				ok = false
+				fmt.Println(aurora.BrightRed(fmt.Sprintf("%s: %s not %s after %s: %s", c.Region, strings.Join(ids, ", "), action.done, elapsed(start), err)))
+				return
+			}
+			fmt.Println(aurora.Bold(aurora.BrightGreen(strings.Join(ids, ", ")+" "+action.done)), aurora.Faint("after "+elapsed(start)))
+		}(client, ids)
+	}
+	wg.Wait()
+	return ok
+}
+
+func init() {
+	ec2Cmd.AddCommand(newLifecycleCmd(startAction, "Start stopped EC2 instances", `Start stopped EC2 instances and wait until they are running.
+
+  awsclihelper ec2 start dev-1 dev-2
+  awsclihelper ec2 start --targets tag:Env=dev --yes`))
+
+	stopCmd := newLifecycleCmd(stopAction, "Stop running EC2 instances", `Stop running EC2 instances and wait until they have stopped. Data on
+instance store volumes is lost when an instance stops.
+
+  awsclihelper ec2 stop --targets tag:Env=dev --yes`)
+	stopCmd.Flags().BoolVar(&stopForce, "force", false, "Force the instances to stop without flushing file systems")
+	ec2Cmd.AddCommand(stopCmd)
+
+	ec2Cmd.AddCommand(newLifecycleCmd(rebootAction, "Reboot running EC2 instances", `Reboot running EC2 instances and wait until their status checks pass.
+The instances stay in the running state while they reboot.`))
+}
@@ -0,0 +1,121 @@
+package ec2
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var lsTargets string
+var lsStates []string
+var lsTags []string
+
+// lsCmd represents the ec2 ls command
+var lsCmd = &cobra.Command{
+	Use:   "ls [instance-id-or-name...]",
+	Short: "List EC2 instances with their state and tags",
+	Long: `List EC2 instances as a table of ID, Name tag, state, type, zone,
+private IP and launch time. Narrow the list with instance IDs or Name tags
+as arguments, --targets tag:Key=Value filters and --state, and add tags
+as extra columns with --tag.
+
+  awsclihelper ec2 ls --targets tag:Env=dev --state stopped --tag Owner`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clients, err := internal.NewClients()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		internal.RegionHeader(clients)
+
+		sets, err := targetFilters(args, lsTargets)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		if len(lsStates) > 0 {
+			for i := range sets {
+				sets[i] = append(sets[i], types.Filter{Name: aws.String("instance-state-name"), Values: lsStates})
+			}
+		}
+
+		instances, err := listInstances(clients, sets)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		if len(instances) == 0 {
+			fmt.Println(aurora.BrightYellow("No instances found"))
+			return
+		}
+		printInstances(instances)
+	},
+}
+
+// printInstances prints instances as a table. Zones name their region, so
+// no region column is needed when several are listed.
+func printInstances(instances []instance) {
+	headers := []string{"INSTANCE", "NAME", "STATE", "TYPE", "ZONE", "PRIVATE IP", "LAUNCHED"}
+	headers = append(headers, lsTags...)
+	const stateColumn = 2
+
+	rows := [][]string{}
+	for _, i := range instances {
+		zone, launched := "", ""
+		if i.Placement != nil {
+			zone = aws.ToString(i.Placement.AvailabilityZone)
+		}
+		if i.LaunchTime != nil {
+			launched = i.LaunchTime.Local().Format("2006-01-02 15:04")
+		}
+		row := []string{i.id(), i.name(), string(i.state()), string(i.InstanceType), zone, aws.ToString(i.PrivateIpAddress), launched}
+		for _, key := range lsTags {
+			row = append(row, i.tag(key))
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(headers))
+	for _, row := range append([][]string{headers}, rows...) {
+		for col, cell := range row {
+			if len(cell) > widths[col] {
+				widths[col] = len(cell)
+			}
+		}
+	}
+	pad := func(col int, cell string) string {
+		return cell + strings.Repeat(" ", widths[col]-len(cell)+2)
+	}
+
+	line := ""
+	for col, header := range headers {
+		line += pad(col, header)
+	}
+	fmt.Println(aurora.Bold(strings.TrimRight(line, " ")))
+
+	for r, row := range rows {
+		line := ""
+		for col, cell := range row {
+			if col == stateColumn {
+				line += stateColour(instances[r].state(), pad(col, cell)).String()
+			} else {
+				line += pad(col, cell)
+			}
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
+
+func init() {
+	ec2Cmd.AddCommand(lsCmd)
+
+	lsCmd.Flags().StringVarP(&lsTargets, "targets", "t", "", "Instance IDs and tag:Key=Value filters, comma separated")
+	lsCmd.Flags().StringSliceVarP(&lsStates, "state", "s", nil, "Only list instances in these states, e.g. running,stopped")
+	lsCmd.Flags().StringSliceVar(&lsTags, "tag", nil, "Tag keys to show as extra columns")
+}
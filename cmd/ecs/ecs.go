@@ -0,0 +1,119 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/jjkirkpatrick/awsclihelper/cmd"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+// ecsCmd represents the ecs command
+var ecsCmd = &cobra.Command{
+	Use:   "ecs",
+	Short: "Manage ECS services and tasks",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func listClusters(c *internal.Client) []internal.Item {
+	clusters := []internal.Item{}
+	paginator := ecs.NewListClustersPaginator(c.ECS, &ecs.ListClustersInput{})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			fmt.Println(aurora.BrightRed(fmt.Sprintf("%s: %s", c.Region, err)))
+			return nil
+		}
+		for _, arn := range output.ClusterArns {
+			clusters = append(clusters, internal.Item{
+				ID:      arn,
+				Label:   internal.ShortArn(arn),
+				Fields:  []string{internal.ShortArn(arn)},
+				Preview: []string{"Cluster  " + arn},
+			})
+		}
+	}
+	return clusters
+}
+
+// selectCluster returns the cluster named by name or ARN, or asks for one
+// when name is empty and there's more than one.
+func selectCluster(clients []*internal.Client, name string) (internal.Item, error) {
+	clusters := internal.Labelled(clients, listClusters)
+
+	if name != "" {
+		for _, cluster := range clusters {
+			if cluster.ID == name || cluster.Fields[0] == name {
+				return cluster, nil
+			}
+		}
+		return internal.Item{}, fmt.Errorf("no cluster named %s", name)
+	}
+
+	if len(clusters) == 0 {
+		return internal.Item{}, fmt.Errorf("no clusters found, please check profile and region")
+	} else if len(clusters) == 1 {
+		return clusters[0], nil
+	}
+	return internal.Pick("Choose a cluster:", "ecs-cluster", clusters)
+}
+
+func listServices(c *internal.Client, clusterArn string) ([]internal.Item, error) {
+	services := []internal.Item{}
+	paginator := ecs.NewListServicesPaginator(c.ECS, &ecs.ListServicesInput{Cluster: aws.String(clusterArn)})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, arn := range output.ServiceArns {
+			services = append(services, internal.Item{
+				ID:      arn,
+				Label:   internal.ShortArn(arn),
+				Fields:  []string{internal.ShortArn(arn)},
+				Preview: []string{"Service  " + arn, "Cluster  " + clusterArn},
+				Client:  c,
+			})
+		}
+	}
+	return services, nil
+}
+
+// selectService returns the service named by name or ARN in a cluster, or
+// asks for one when name is empty.
+func selectService(c *internal.Client, clusterArn string, name string) (string, error) {
+	services, err := listServices(c, clusterArn)
+	if err != nil {
+		return "", err
+	}
+
+	if name != "" {
+		for _, service := range services {
+			if service.ID == name || service.Fields[0] == name {
+				return service.ID, nil
+			}
+		}
+		return "", fmt.Errorf("no service named %s in %s", name, internal.ShortArn(clusterArn))
+	}
+
+	if len(services) == 0 {
+		return "", fmt.Errorf("no services in %s", internal.ShortArn(clusterArn))
+	} else if len(services) == 1 {
+		return services[0].ID, nil
+	}
+	choice, err := internal.Pick("Choose a service:", "ecs-service", services)
+	if err != nil {
+		return "", err
+	}
+	return choice.ID, nil
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(ecsCmd)
+}
@@ -0,0 +1,330 @@
+package ecs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var execCluster string
+var execService string
+var execTasks []string
+var execAll bool
+var execContainer string
+var execConcurrency int
+var execTimeout time.Duration
+
+// execExitMarker is printed after the command with its exit status, as
+// the session doesn't report it.
+const execExitMarker = "__AWSCLIHELPER_EXIT__"
+
+// Lines the Session Manager plugin adds around the command's output.
+var sessionNoise = []string{
+	"Starting session with SessionId:",
+	"Exiting session with sessionId:",
+	"The Session Manager plugin was installed successfully.",
+}
+
+type execResult struct {
+	task     string
+	exitCode int
+	err      error
+}
+
+// execCmd represents the ecs exec command
+var execCmd = &cobra.Command{
+	Use:   "exec [--task id] -- <command>",
+	Short: "Run a command in ECS tasks and collect its output and exit code",
+	Long: `Run a one-off command in one or more ECS tasks through ECS Exec, without
+an interactive shell, printing its output prefixed with the task ID.
+
+Tasks are given with --task, or all of a service's tasks with --service
+and --all, or chosen from a list. With a single task the command exits
+with the remote command's exit code, otherwise it exits non-zero if the
+command failed in any task.
+
+  awsclihelper ecs exec -c prod -s web --task 0123abcd -- bundle exec rails db:migrate
+  awsclihelper ecs exec -c prod -s web --all -- env`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		command := strings.Join(args, " ")
+
+		clients, err := internal.NewClients()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		internal.RegionHeader(clients)
+
+		cluster, err := selectCluster(clients, execCluster)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		tasks, err := selectTasks(cluster.Client, cluster.ID)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		results := execAllTasks(cluster.Client, cluster.ID, tasks, command)
+		if len(results) == 1 {
+			if results[0].err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(results[0].err)))
+				os.Exit(1)
+			}
+			os.Exit(results[0].exitCode)
+		}
+		if !printExecSummary(results) {
+			os.Exit(1)
+		}
+	},
+}
+
+// selectTasks resolves --task, or lists the running tasks of a service
+// and uses all of them with --all or asks which to use.
+func selectTasks(c *internal.Client, clusterArn string) ([]string, error) {
+	if len(execTasks) > 0 {
+		return execTasks, nil
+	}
+
+	serviceArn, err := selectService(c, clusterArn, execService)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []string{}
+	paginator := ecs.NewListTasksPaginator(c.ECS, &ecs.ListTasksInput{
+		Cluster:       aws.String(clusterArn),
+		ServiceName:   aws.String(internal.ShortArn(serviceArn)),
+		DesiredStatus: types.DesiredStatusRunning,
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, output.TaskArns...)
+	}
+
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("no running tasks in %s", internal.ShortArn(serviceArn))
+	} else if len(tasks) == 1 || execAll {
+		return tasks, nil
+	}
+
+	items := []internal.Item{}
+	for _, task := range tasks {
+		items = append(items, internal.Item{ID: task, Label: internal.ShortArn(task), Preview: []string{"Task     " + task, "Service  " + serviceArn}})
+	}
+	chosen, err := internal.PickMany("Choose tasks to run in:", "ecs-task", items)
+	if err != nil {
+		return nil, err
+	}
+	tasks = []string{}
+	for _, item := range chosen {
+		tasks = append(tasks, item.ID)
+	}
+	return tasks, nil
+}
+
+// execAllTasks runs the command in every task, at most --max-concurrency
+// at a time.
+func execAllTasks(c *internal.Client, clusterArn string, tasks []string, command string) []execResult {
+	var printMu sync.Mutex
+	var wg sync.WaitGroup
+	results := make([]execResult, len(tasks))
+	if execConcurrency < 1 {
+		execConcurrency = 1
+	}
+	limit := make(chan struct{}, execConcurrency)
+
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task string) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			exitCode, err := execTask(c, clusterArn, task, command, &printMu)
+			results[i] = execResult{task: internal.ShortArn(task), exitCode: exitCode, err: err}
+		}(i, task)
+	}
+	wg.Wait()
+	return results
+}
+
+// execTask runs a command in a task through an execute-command session,
+// returning the command's exit code.
+func execTask(c *internal.Client, clusterArn string, task string, command string, printMu *sync.Mutex) (int, error) {
+	start := time.Now()
+	ctx := context.Background()
+	if execTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, execTimeout)
+		defer cancel()
+	}
+
+	script := fmt.Sprintf("%s; printf '%s %%s\\n' $?", command, execExitMarker)
+	args := []string{
+		"ecs", "execute-command",
+		"--cluster=" + clusterArn,
+		"--task=" + task,
+		"--interactive",
+		"--command=sh -c " + internal.ShellQuote(script),
+	}
+	if execContainer != "" {
+		args = append(args, "--container="+execContainer)
+	}
+	args = append(args, c.CLIArgs()...)
+
+	// The session only runs in interactive mode, so stdin is held open
+	// until the command finishes rather than sent EOF straight away.
+	session := exec.CommandContext(ctx, "aws", args...)
+	session.Env = c.CLIEnv()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return -1, err
+	}
+	defer stdin.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return -1, err
+	}
+	session.Stderr = &prefixWriter{prefix: shortID(task), mu: printMu}
+	if err := session.Start(); err != nil {
+		return -1, err
+	}
+
+	exitCode := -1
+	prefix := aurora.BrightCyan(fmt.Sprintf("[%s]", shortID(task)))
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// Output without a trailing newline runs into the marker.
+		if i := strings.Index(line, execExitMarker); i != -1 {
+			exitCode, _ = strconv.Atoi(strings.TrimSpace(line[i+len(execExitMarker):]))
+			if line = line[:i]; line == "" {
+				continue
+			}
+		} else if isSessionNoise(line) {
+			continue
+		}
+		printMu.Lock()
+		fmt.Println(prefix, line)
+		printMu.Unlock()
+	}
+	stdin.Close()
+	waitErr := session.Wait()
+
+	if exitCode == -1 {
+		err = errors.New("the session ended before the command finished")
+		if ctx.Err() != nil {
+			err = fmt.Errorf("timed out after %s", execTimeout)
+		} else if waitErr != nil {
+			err = fmt.Errorf("%s: %w", err.Error(), waitErr)
+		}
+	}
+	c.AuditSession(task, "ecs execute-command", start, exitCode, err)
+	return exitCode, err
+}
+
+func isSessionNoise(line string) bool {
+	for _, noise := range sessionNoise {
+		if strings.HasPrefix(line, noise) {
+			return true
+		}
+	}
+	return false
+}
+
+// shortID shortens a task ARN to the start of its ID for output prefixes.
+func shortID(task string) string {
+	id := internal.ShortArn(task)
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// prefixWriter prints each line written to it to stderr, prefixed with a
+// task ID.
+type prefixWriter struct {
+	prefix string
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := strings.IndexByte(string(w.buf), '\n')
+		if i == -1 {
+			return len(p), nil
+		}
+		line := strings.TrimRight(string(w.buf[:i]), "\r")
+		w.buf = w.buf[i+1:]
+		if isSessionNoise(line) {
+			continue
+		}
+		w.mu.Lock()
+		fmt.Fprintln(os.Stderr, aurora.BrightCyan(fmt.Sprintf("[%s]", w.prefix)), aurora.BrightRed(line))
+		w.mu.Unlock()
+	}
+}
+
+// printExecSummary reports each task's exit code, returning false if the
+// command failed in any of them.
+func printExecSummary(results []execResult) bool {
+	sort.Slice(results, func(i, j int) bool { return results[i].task < results[j].task })
+
+	fmt.Println()
+	fmt.Println(aurora.Bold("Summary"))
+	succeeded := 0
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			fmt.Printf("  %-34s %s\n", r.task, aurora.BrightRed(r.err))
+		case r.exitCode == 0:
+			succeeded++
+			fmt.Printf("  %-34s %s\n", r.task, aurora.BrightGreen("exit 0"))
+		default:
+			fmt.Printf("  %-34s %s\n", r.task, aurora.BrightRed(fmt.Sprintf("exit %d", r.exitCode)))
+		}
+	}
+
+	failed := len(results) - succeeded
+	if failed > 0 {
+		fmt.Println(aurora.Bold(aurora.BrightRed(fmt.Sprintf("%d succeeded, %d failed", succeeded, failed))))
+		return false
+	}
+	fmt.Println(aurora.Bold(aurora.BrightGreen(fmt.Sprintf("%d succeeded", succeeded))))
+	return true
+}
+
+func init() {
+	ecsCmd.AddCommand(execCmd)
+
+	execCmd.Flags().StringVarP(&execCluster, "cluster", "c", "", "Cluster name or ARN")
+	execCmd.Flags().StringVarP(&execService, "service", "s", "", "Service name or ARN to choose tasks from")
+	execCmd.Flags().StringSliceVarP(&execTasks, "task", "t", nil, "Task IDs or ARNs to run in")
+	execCmd.Flags().BoolVarP(&execAll, "all", "a", false, "Run in every running task of the service")
+	execCmd.Flags().StringVar(&execContainer, "container", "", "Container to run in, required for tasks with several containers")
+	execCmd.Flags().IntVar(&execConcurrency, "max-concurrency", 5, "Maximum tasks to run in at once")
+	execCmd.Flags().DurationVar(&execTimeout, "timeout", 0, "Maximum time the command may run in each task")
+}
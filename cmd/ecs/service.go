@@ -0,0 +1,348 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var serviceCluster string
+var serviceName string
+var serviceYes bool
+var serviceWatch bool
+var scaleDesired int32
+var watchTimeout time.Duration
+
+// How many past service events to show when a watch starts.
+const watchHistory = 3
+
+// serviceCmd represents the ecs service command
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Redeploy, scale and watch ECS services",
+	Long: `Redeploy, scale and watch ECS services. The cluster and service are
+given with --cluster and --service by name or ARN, or chosen from a list.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var redeployCmd = &cobra.Command{
+	Use:   "redeploy",
+	Short: "Force a new deployment of a service",
+	Long: `Force a new deployment of a service, replacing its tasks with new ones
+from the same task definition. Use it to pick up a new image pushed to
+the same tag, or refreshed secrets.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, clusterArn, serviceArn := selectTarget()
+
+		if !serviceYes && !confirm(fmt.Sprintf("Force a new deployment of %s?", internal.ShortArn(serviceArn))) {
+			os.Exit(1)
+		}
+		_, err := c.ECS.UpdateService(context.TODO(), &ecs.UpdateServiceInput{
+			Cluster:            aws.String(clusterArn),
+			Service:            aws.String(serviceArn),
+			ForceNewDeployment: true,
+		})
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		fmt.Println(aurora.BrightGreen("Started a new deployment of"), aurora.BrightCyan(internal.ShortArn(serviceArn)))
+
+		if serviceWatch && !watchService(c, clusterArn, serviceArn) {
+			os.Exit(1)
+		}
+	},
+}
+
+var scaleCmd = &cobra.Command{
+	Use:   "scale --desired N",
+	Short: "Change the number of tasks a service runs",
+	Run: func(cmd *cobra.Command, args []string) {
+		if scaleDesired < 0 {
+			fmt.Println(aurora.Bold(aurora.BrightRed("--desired must not be negative")))
+			os.Exit(1)
+		}
+		c, clusterArn, serviceArn := selectTarget()
+
+		service, err := describeService(c, clusterArn, serviceArn)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		message := fmt.Sprintf("Scale %s from %d to %d tasks?", internal.ShortArn(serviceArn), service.DesiredCount, scaleDesired)
+		if !serviceYes && !confirm(message) {
+			os.Exit(1)
+		}
+
+		_, err = c.ECS.UpdateService(context.TODO(), &ecs.UpdateServiceInput{
+			Cluster:      aws.String(clusterArn),
+			Service:      aws.String(serviceArn),
+			DesiredCount: aws.Int32(scaleDesired),
+		})
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		fmt.Println(aurora.BrightGreen("Scaled"), aurora.BrightCyan(internal.ShortArn(serviceArn)), aurora.BrightGreen(fmt.Sprintf("to %d tasks", scaleDesired)))
+
+		if serviceWatch && !watchService(c, clusterArn, serviceArn) {
+			os.Exit(1)
+		}
+	},
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Follow a service rollout until it is steady or rolled back",
+	Long: `Follow a service's deployments, showing each PRIMARY and ACTIVE
+deployment's running, pending and failed task counts, why failed tasks
+stopped, and new service events.
+
+Exits 0 once the service reaches a steady state, and 1 if the deployment
+fails, such as when the deployment circuit breaker rolls it back, or if
+--timeout passes first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, clusterArn, serviceArn := selectTarget()
+		if !watchService(c, clusterArn, serviceArn) {
+			os.Exit(1)
+		}
+	},
+}
+
+// selectTarget resolves the --cluster and --service flags, exiting if
+// either can't be found.
+func selectTarget() (*internal.Client, string, string) {
+	clients, err := internal.NewClients()
+	if err != nil {
+		fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+		os.Exit(1)
+	}
+	internal.RegionHeader(clients)
+
+	cluster, err := selectCluster(clients, serviceCluster)
+	if err != nil {
+		fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+		os.Exit(1)
+	}
+	serviceArn, err := selectService(cluster.Client, cluster.ID, serviceName)
+	if err != nil {
+		fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+		os.Exit(1)
+	}
+	return cluster.Client, cluster.ID, serviceArn
+}
+
+func confirm(message string) bool {
+	confirmation := false
+	prompt := &survey.Confirm{
+		Message: message,
+	}
+	survey.AskOne(prompt, &confirmation)
+	return confirmation
+}
+
+func describeService(c *internal.Client, clusterArn string, serviceArn string) (types.Service, error) {
+	output, err := c.ECS.DescribeServices(context.TODO(), &ecs.DescribeServicesInput{
+		Cluster:  aws.String(clusterArn),
+		Services: []string{serviceArn},
+	})
+	if err != nil {
+		return types.Service{}, err
+	}
+	if len(output.Services) == 0 {
+		return types.Service{}, fmt.Errorf("service %s not found", internal.ShortArn(serviceArn))
+	}
+	return output.Services[0], nil
+}
+
+// watchService polls a service until its rollout finishes, returning true
+// if it reached a steady state.
+func watchService(c *internal.Client, clusterArn string, serviceArn string) bool {
+	start := time.Now()
+	seenEvents := map[string]bool{}
+	seenTasks := map[string]bool{}
+	lastStatus := ""
+	lastFailed := int32(0)
+	first := true
+
+	for {
+		service, err := describeService(c, clusterArn, serviceArn)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			return false
+		}
+
+		printEvents(service.Events, seenEvents, first)
+		if status := deploymentStatus(service); status != lastStatus {
+			fmt.Print(status)
+			lastStatus = status
+		}
+
+		failed := int32(0)
+		for _, deployment := range service.Deployments {
+			failed += deployment.FailedTasks
+		}
+		if failed > lastFailed {
+			printStoppedTasks(c, clusterArn, internal.ShortArn(serviceArn), start, seenTasks)
+		}
+		lastFailed = failed
+
+		if done, ok, message := rolloutResult(service); done {
+			if ok {
+				fmt.Println(aurora.Bold(aurora.BrightGreen(message)))
+			} else {
+				fmt.Println(aurora.Bold(aurora.BrightRed(message)))
+			}
+			return ok
+		}
+		if time.Since(start) > watchTimeout {
+			fmt.Println(aurora.Bold(aurora.BrightRed(fmt.Sprintf("%s has not reached a steady state after %s", internal.ShortArn(serviceArn), watchTimeout))))
+			return false
+		}
+
+		first = false
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// printEvents prints service events not already seen, oldest first. Only
+// the most recent few are shown on the first poll.
+func printEvents(events []types.ServiceEvent, seen map[string]bool, first bool) {
+	// Events are returned newest first.
+	unseen := []types.ServiceEvent{}
+	for _, event := range events {
+		if seen[aws.ToString(event.Id)] {
+			continue
+		}
+		seen[aws.ToString(event.Id)] = true
+		if !first || len(unseen) < watchHistory {
+			unseen = append(unseen, event)
+		}
+	}
+	for i := len(unseen) - 1; i >= 0; i-- {
+		event := unseen[i]
+		at := ""
+		if event.CreatedAt != nil {
+			at = event.CreatedAt.Local().Format("15:04:05")
+		}
+		fmt.Println(aurora.Faint(at), aws.ToString(event.Message))
+	}
+}
+
+// deploymentStatus describes each of a service's deployments, one per line.
+func deploymentStatus(service types.Service) string {
+	var b strings.Builder
+	for _, d := range service.Deployments {
+		status := aws.ToString(d.Status)
+		counts := fmt.Sprintf("running %d/%d  pending %d  failed %d", d.RunningCount, d.DesiredCount, d.PendingCount, d.FailedTasks)
+		rollout := string(d.RolloutState)
+		if reason := aws.ToString(d.RolloutStateReason); reason != "" && d.RolloutState != types.DeploymentRolloutStateInProgress {
+			rollout += ": " + reason
+		}
+
+		var state aurora.Value
+		switch d.RolloutState {
+		case types.DeploymentRolloutStateCompleted:
+			state = aurora.BrightGreen(rollout)
+		case types.DeploymentRolloutStateFailed:
+			state = aurora.BrightRed(rollout)
+		default:
+			state = aurora.BrightYellow(rollout)
+		}
+		fmt.Fprintf(&b, "  %-8s %-28s %s  %s\n", status, internal.ShortArn(aws.ToString(d.TaskDefinition)), counts, state)
+	}
+	return b.String()
+}
+
+// rolloutResult reports whether the rollout has finished and whether it
+// succeeded. A failed deployment means the circuit breaker is rolling back
+// or the deployment was stopped.
+func rolloutResult(service types.Service) (bool, bool, string) {
+	for _, d := range service.Deployments {
+		if d.RolloutState == types.DeploymentRolloutStateFailed {
+			message := fmt.Sprintf("Deployment of %s failed", internal.ShortArn(aws.ToString(d.TaskDefinition)))
+			if reason := aws.ToString(d.RolloutStateReason); reason != "" {
+				message += ": " + reason
+			}
+			return true, false, message
+		}
+	}
+
+	if len(service.Deployments) != 1 {
+		return false, false, ""
+	}
+	d := service.Deployments[0]
+	if d.RolloutState == types.DeploymentRolloutStateInProgress || d.RunningCount != d.DesiredCount || d.PendingCount != 0 {
+		return false, false, ""
+	}
+	return true, true, fmt.Sprintf("%s reached a steady state with %d tasks running", aws.ToString(service.ServiceName), d.RunningCount)
+}
+
+// printStoppedTasks prints why tasks in the service stopped since the watch
+// started.
+func printStoppedTasks(c *internal.Client, clusterArn string, service string, since time.Time, seen map[string]bool) {
+	list, err := c.ECS.ListTasks(context.TODO(), &ecs.ListTasksInput{
+		Cluster:       aws.String(clusterArn),
+		ServiceName:   aws.String(service),
+		DesiredStatus: types.DesiredStatusStopped,
+	})
+	if err != nil || len(list.TaskArns) == 0 {
+		return
+	}
+	output, err := c.ECS.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
+		Cluster: aws.String(clusterArn),
+		Tasks:   list.TaskArns,
+	})
+	if err != nil {
+		return
+	}
+
+	for _, task := range output.Tasks {
+		id := internal.ShortArn(aws.ToString(task.TaskArn))
+		if seen[id] || task.StoppedAt == nil || task.StoppedAt.Before(since) {
+			continue
+		}
+		seen[id] = true
+		fmt.Println(aurora.BrightRed("  Task "+id+" stopped:"), aws.ToString(task.StoppedReason))
+		for _, container := range task.Containers {
+			if container.ExitCode == nil && container.Reason == nil {
+				continue
+			}
+			detail := aws.ToString(container.Reason)
+			if container.ExitCode != nil {
+				detail = strings.TrimSpace(fmt.Sprintf("exit %d %s", *container.ExitCode, detail))
+			}
+			fmt.Println(aurora.Faint("    " + aws.ToString(container.Name) + ": " + detail))
+		}
+	}
+}
+
+func init() {
+	ecsCmd.AddCommand(serviceCmd)
+	serviceCmd.AddCommand(redeployCmd)
+	serviceCmd.AddCommand(scaleCmd)
+	serviceCmd.AddCommand(watchCmd)
+
+	serviceCmd.PersistentFlags().StringVarP(&serviceCluster, "cluster", "c", "", "Cluster name or ARN")
+	serviceCmd.PersistentFlags().StringVarP(&serviceName, "service", "s", "", "Service name or ARN")
+	serviceCmd.PersistentFlags().DurationVar(&watchTimeout, "timeout", 30*time.Minute, "Maximum time to watch a rollout")
+
+	for _, command := range []*cobra.Command{redeployCmd, scaleCmd} {
+		command.Flags().BoolVarP(&serviceYes, "yes", "y", false, "Don't ask for confirmation")
+		command.Flags().BoolVarP(&serviceWatch, "watch", "w", false, "Watch the rollout until it is steady or rolled back")
+	}
+	scaleCmd.Flags().Int32Var(&scaleDesired, "desired", 0, "Number of tasks to run")
+	scaleCmd.MarkFlagRequired("desired")
+}
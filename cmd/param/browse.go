@@ -0,0 +1,176 @@
+package param
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+// browseCmd represents the param browse command
+var browseCmd = &cobra.Command{
+	Use:   "browse [path]",
+	Short: "Browse parameters as a tree",
+	Long: `Browse the parameters beneath a path one level at a time. Choose a
+folder to open it, .. to go back up, or a parameter to print its value.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		root := "/"
+		if len(args) == 1 {
+			root = cleanPath(args[0])
+		}
+
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		metadata, err := describeParameters(c, root, true)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		if len(metadata) == 0 {
+			fmt.Println(aurora.BrightYellow("No parameters under " + root))
+			return
+		}
+
+		if err := browse(c, root, metadata); err != nil && !errors.Is(err, internal.ErrCancelled) {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+	},
+}
+
+func browse(c *internal.Client, root string, metadata []types.ParameterMetadata) error {
+	current := root
+	for {
+		items, folders := treeLevel(root, current, metadata)
+		choice, err := internal.Pick(current, "param", items)
+		if err != nil {
+			return err
+		}
+		if folders[choice.ID] {
+			current = folderPath(choice.ID)
+			continue
+		}
+
+		parameters, err := getParameters(c, []string{choice.ID})
+		if err != nil {
+			return err
+		}
+		if len(parameters) == 0 {
+			return fmt.Errorf("parameter %s not found", choice.ID)
+		}
+		p := parameters[0]
+		fmt.Println(aurora.BrightCyan(choice.ID), aurora.Faint(fmt.Sprintf("%s v%d", p.Type, p.Version)))
+		fmt.Println(aws.ToString(p.Value))
+		return nil
+	}
+}
+
+// treeLevel returns the folders and parameters directly in current, along
+// with which of the item IDs are folders. Folder IDs end in a / so they
+// can't clash with a parameter of the same name.
+func treeLevel(root string, current string, metadata []types.ParameterMetadata) ([]internal.Item, map[string]bool) {
+	folders := map[string]bool{}
+	counts := map[string]int{}
+	leaves := []internal.Item{}
+
+	for _, m := range metadata {
+		name := aws.ToString(m.Name)
+		if current != "/" && !strings.HasPrefix(name, current+"/") {
+			continue
+		}
+		rest := relativeName(current, name)
+		if i := strings.Index(rest, "/"); i != -1 {
+			folder := joinPath(current, rest[:i])
+			counts[folder]++
+			continue
+		}
+		leaves = append(leaves, parameterItem(rest, m))
+	}
+
+	items := []internal.Item{}
+	if current != root {
+		parent := current[:strings.LastIndex(current, "/")]
+		if parent == "" {
+			parent = "/"
+		}
+		folders[folderID(parent)] = true
+		items = append(items, internal.Item{ID: folderID(parent), Label: "..", Preview: []string{"Back to " + parent}})
+	}
+
+	names := []string{}
+	for folder := range counts {
+		names = append(names, folder)
+	}
+	sort.Strings(names)
+	for _, folder := range names {
+		folders[folderID(folder)] = true
+		items = append(items, internal.Item{
+			ID:      folderID(folder),
+			Label:   folder[strings.LastIndex(folder, "/")+1:] + "/",
+			Preview: []string{folder, fmt.Sprintf("%d parameters", counts[folder])},
+		})
+	}
+	return append(items, leaves...), folders
+}
+
+// folderID returns the item ID of a folder, its path with a trailing /.
+func folderID(path string) string {
+	if path == "/" {
+		return path
+	}
+	return path + "/"
+}
+
+// folderPath returns the path of a folder from its item ID.
+func folderPath(id string) string {
+	if id == "/" {
+		return id
+	}
+	return strings.TrimSuffix(id, "/")
+}
+
+func joinPath(path string, name string) string {
+	if path == "/" {
+		return "/" + name
+	}
+	return path + "/" + name
+}
+
+func parameterItem(label string, m types.ParameterMetadata) internal.Item {
+	modified := ""
+	if m.LastModifiedDate != nil {
+		modified = m.LastModifiedDate.Local().Format("2006-01-02 15:04")
+	}
+	preview := []string{
+		aws.ToString(m.Name),
+		"",
+		"Type         " + string(m.Type),
+		"Tier         " + string(m.Tier),
+		fmt.Sprintf("Version      %d", m.Version),
+		"Modified     " + modified,
+		"Modified by  " + aws.ToString(m.LastModifiedUser),
+	}
+	if m.KeyId != nil {
+		preview = append(preview, "KMS key      "+aws.ToString(m.KeyId))
+	}
+	if m.Description != nil {
+		preview = append(preview, "", aws.ToString(m.Description))
+	}
+	return internal.Item{ID: aws.ToString(m.Name), Label: label, Fields: []string{string(m.Type)}, Preview: preview}
+}
+
+func init() {
+	paramCmd.AddCommand(browseCmd)
+}
@@ -0,0 +1,122 @@
+package param
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var diffShowSecrets bool
+
+// paramChange is the difference between a parameter in two paths.
+type paramChange struct {
+	name string
+	from *parameter
+	to   *parameter
+}
+
+// diffCmd represents the param diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <path-a> <path-b>",
+	Short: "Compare the parameters under two paths",
+	Long: `Compare everything beneath two paths by name relative to each path,
+listing parameters only in one of them and those whose value or type
+differ. SecureString values are compared but only shown with
+--show-secrets.
+
+  awsclihelper param diff /app/staging /app/prod`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		from, to := cleanPath(args[0]), cleanPath(args[1])
+
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		a, err := loadParameters(c, from, true)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		b, err := loadParameters(c, to, true)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		changes := diffParameters(from, a, to, b)
+		if len(changes) == 0 {
+			fmt.Println(aurora.BrightGreen(fmt.Sprintf("%s and %s are the same", from, to)))
+			return
+		}
+		printChanges(changes, diffShowSecrets)
+	},
+}
+
+// diffParameters pairs up parameters by their name relative to each path,
+// returning those that differ sorted by relative name.
+func diffParameters(fromPath string, from []parameter, toPath string, to []parameter) []paramChange {
+	byName := map[string]*paramChange{}
+	for i := range from {
+		name := relativeName(fromPath, from[i].name())
+		byName[name] = &paramChange{name: name, from: &from[i]}
+	}
+	for i := range to {
+		name := relativeName(toPath, to[i].name())
+		if byName[name] == nil {
+			byName[name] = &paramChange{name: name}
+		}
+		byName[name].to = &to[i]
+	}
+
+	changes := []paramChange{}
+	for _, change := range byName {
+		if change.from != nil && change.to != nil && change.from.Value == change.to.Value && change.from.Type == change.to.Type {
+			continue
+		}
+		changes = append(changes, *change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].name < changes[j].name })
+	return changes
+}
+
+// printChanges prints changes as - for parameters only in the first path,
+// + for those only in the second and ~ for those in both that differ.
+func printChanges(changes []paramChange, showSecrets bool) {
+	show := func(p *parameter) string {
+		if p.secure() && !showSecrets {
+			return "(" + string(p.Type) + ")"
+		}
+		return p.Value
+	}
+
+	for _, change := range changes {
+		switch {
+		case change.to == nil:
+			fmt.Println(aurora.BrightRed("- "+change.name), aurora.Faint(show(change.from)))
+		case change.from == nil:
+			fmt.Println(aurora.BrightGreen("+ "+change.name), aurora.Faint(show(change.to)))
+		default:
+			fmt.Println(aurora.BrightYellow("~ " + change.name))
+			if change.from.Type != change.to.Type {
+				fmt.Println(aurora.BrightRed("    - type "+string(change.from.Type)), aurora.BrightGreen("+ type "+string(change.to.Type)))
+			}
+			if change.from.Value != change.to.Value {
+				fmt.Println(aurora.BrightRed("    - " + show(change.from)))
+				fmt.Println(aurora.BrightGreen("    + " + show(change.to)))
+			}
+		}
+	}
+}
+
+func init() {
+	paramCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().BoolVar(&diffShowSecrets, "show-secrets", false, "Show SecureString values that differ")
+}
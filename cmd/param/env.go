@@ -0,0 +1,183 @@
+package param
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+// envMapping holds the rules for turning parameter names into environment
+// variable names.
+type envMapping struct {
+	keepPath  bool
+	prefix    string
+	nameCase  string
+	recursive bool
+}
+
+var mapping envMapping
+var envFormat string
+
+var unsafeEnvChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// envCmd represents the param env command
+var envCmd = &cobra.Command{
+	Use:   "env <path>",
+	Short: "Print the parameters under a path as environment variables",
+	Long: `Print the parameters beneath a path as environment variables, in dotenv,
+shell export or JSON format. SecureStrings are decrypted.
+
+Variable names are the parameter names with the path stripped, slashes,
+dashes and dots turned into underscores, and upper cased, so
+/app/prod/db/host becomes DB_HOST. See the flags to change this.
+
+  eval "$(awsclihelper param env /app/prod --format shell)"`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		env, err := loadEnv(cleanPath(args[0]))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		if err := printEnv(env, envFormat); err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+	},
+}
+
+// paramExecCmd represents the param exec command
+var paramExecCmd = &cobra.Command{
+	Use:   "exec <path> -- <command>",
+	Short: "Run a local command with the parameters under a path in its environment",
+	Long: `Run a local command with the parameters beneath a path added to its
+environment, named as for param env. Parameters override variables
+already set. Nothing is written to disk.
+
+  awsclihelper param exec /app/prod -- bundle exec rails console`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		env, err := loadEnv(cleanPath(args[0]))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		environ := os.Environ()
+		for _, name := range sortedKeys(env) {
+			environ = append(environ, name+"="+env[name])
+		}
+
+		err = internal.RunCommandEnv(environ, args[1], args[2:]...)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+	},
+}
+
+// loadEnv reads the parameters under path and maps them to environment
+// variables. Names that collide are reported and the later one kept.
+func loadEnv(path string) (map[string]string, error) {
+	c, err := internal.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	parameters, err := loadParameters(c, path, mapping.recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{}
+	sources := map[string]string{}
+	for _, p := range parameters {
+		name := mapping.envName(path, p.name())
+		if name == "" {
+			continue
+		}
+		if source, ok := sources[name]; ok {
+			fmt.Fprintln(os.Stderr, aurora.BrightYellow(fmt.Sprintf("%s and %s both map to %s, using %s", source, p.name(), name, p.name())))
+		}
+		sources[name] = p.name()
+		env[name] = p.Value
+	}
+	return env, nil
+}
+
+// envName maps a parameter name to an environment variable name.
+func (m envMapping) envName(path string, name string) string {
+	if !m.keepPath {
+		name = relativeName(path, name)
+	}
+	name = strings.Trim(unsafeEnvChars.ReplaceAllString(name, "_"), "_")
+	switch m.nameCase {
+	case "upper":
+		name = strings.ToUpper(name)
+	case "lower":
+		name = strings.ToLower(name)
+	}
+	name = m.prefix + name
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+func printEnv(env map[string]string, format string) error {
+	switch format {
+	case "dotenv":
+		// Double quoted values are expanded by most dotenv loaders and
+		// shells, so $ and ` are escaped as well.
+		replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", `\$`, "`", "\\`")
+		for _, name := range sortedKeys(env) {
+			fmt.Printf("%s=\"%s\"\n", name, replacer.Replace(env[name]))
+		}
+	case "shell":
+		for _, name := range sortedKeys(env) {
+			fmt.Printf("export %s='%s'\n", name, strings.ReplaceAll(env[name], "'", `'\''`))
+		}
+	case "json":
+		data, err := json.MarshalIndent(env, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	default:
+		return fmt.Errorf("unknown format %s, use dotenv, shell or json", format)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func init() {
+	paramCmd.AddCommand(envCmd)
+	paramCmd.AddCommand(paramExecCmd)
+
+	envCmd.Flags().StringVarP(&envFormat, "format", "f", "dotenv", "Output format: dotenv, shell or json")
+	for _, command := range []*cobra.Command{envCmd, paramExecCmd} {
+		command.Flags().BoolVar(&mapping.keepPath, "keep-path", false, "Keep the path in variable names rather than stripping it")
+		command.Flags().StringVar(&mapping.prefix, "prefix", "", "Prefix to add to every variable name")
+		command.Flags().StringVar(&mapping.nameCase, "case", "upper", "Variable name case: upper, lower or keep")
+		command.Flags().BoolVarP(&mapping.recursive, "recursive", "R", true, "Include parameters in sub-paths")
+	}
+}
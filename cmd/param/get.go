@@ -0,0 +1,171 @@
+package param
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var setType string
+var setKeyID string
+var setDescription string
+var setTier string
+
+// getCmd represents the param get command
+var getCmd = &cobra.Command{
+	Use:   "get <name>...",
+	Short: "Print parameter values, decrypting SecureStrings",
+	Long: `Print the value of a parameter, or the name and value of each of several
+parameters. SecureString values are decrypted.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		parameters, err := getParameters(c, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		values := map[string]string{}
+		for _, p := range parameters {
+			values[aws.ToString(p.Name)] = aws.ToString(p.Value)
+		}
+
+		missing := false
+		for _, name := range args {
+			value, ok := values[name]
+			switch {
+			case !ok:
+				missing = true
+				fmt.Fprintln(os.Stderr, aurora.BrightRed("Parameter "+name+" not found"))
+			case len(args) == 1:
+				// A lone value is printed as is, for use in scripts.
+				fmt.Println(value)
+			default:
+				fmt.Println(aurora.BrightCyan(name), value)
+			}
+		}
+		if missing {
+			os.Exit(1)
+		}
+	},
+}
+
+// setCmd represents the param set command
+var setCmd = &cobra.Command{
+	Use:   "set <name> <value>",
+	Short: "Create a parameter or a new version of one",
+	Long: `Create a parameter, or a new version of an existing one. Give the value
+as - to read it from stdin, which keeps secrets out of shell history.
+
+Existing parameters keep their type, KMS key and tier unless they're
+given. New parameters are Strings unless --type is given.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name, value := args[0], args[1]
+		if value == "-" {
+			data, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(1)
+			}
+			value = strings.TrimRight(string(data), "\n")
+		}
+
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		version, err := putParameter(c, name, value)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		fmt.Println(aurora.BrightGreen("Set"), aurora.BrightCyan(name), aurora.BrightGreen(fmt.Sprintf("version %d", version)))
+	},
+}
+
+func putParameter(c *internal.Client, name string, value string) (int64, error) {
+	input := &ssm.PutParameterInput{
+		Name:  aws.String(name),
+		Value: aws.String(value),
+		Type:  types.ParameterType(setType),
+		Tier:  types.ParameterTier(setTier),
+	}
+	if setKeyID != "" {
+		input.KeyId = aws.String(setKeyID)
+	}
+	if setDescription != "" {
+		input.Description = aws.String(setDescription)
+	}
+
+	existing, err := describeParameter(c, name)
+	if err != nil {
+		return 0, err
+	}
+	if existing != nil {
+		input.Overwrite = true
+		if input.Type == "" {
+			input.Type = existing.Type
+		}
+		if input.KeyId == nil && input.Type == types.ParameterTypeSecureString && existing.Type == types.ParameterTypeSecureString {
+			input.KeyId = existing.KeyId
+		}
+		// Advanced parameters can't be moved back to the standard tier.
+		if input.Tier == "" {
+			input.Tier = existing.Tier
+		}
+	} else if input.Type == "" {
+		input.Type = types.ParameterTypeString
+	}
+
+	output, err := c.SSM.PutParameter(context.TODO(), input)
+	if err != nil {
+		return 0, err
+	}
+	return output.Version, nil
+}
+
+// describeParameter returns a parameter's metadata, or nil if it doesn't
+// exist.
+func describeParameter(c *internal.Client, name string) (*types.ParameterMetadata, error) {
+	output, err := c.SSM.DescribeParameters(context.TODO(), &ssm.DescribeParametersInput{
+		ParameterFilters: []types.ParameterStringFilter{{
+			Key:    aws.String("Name"),
+			Option: aws.String("Equals"),
+			Values: []string{name},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Parameters) == 0 {
+		return nil, nil
+	}
+	return &output.Parameters[0], nil
+}
+
+func init() {
+	paramCmd.AddCommand(getCmd)
+	paramCmd.AddCommand(setCmd)
+
+	setCmd.Flags().StringVarP(&setType, "type", "t", "", "String, StringList or SecureString")
+	setCmd.Flags().StringVar(&setKeyID, "key-id", "", "KMS key to encrypt a SecureString with (default the account's aws/ssm key)")
+	setCmd.Flags().StringVar(&setDescription, "description", "", "Parameter description")
+	setCmd.Flags().StringVar(&setTier, "tier", "", "Standard, Advanced or Intelligent-Tiering")
+}
@@ -0,0 +1,72 @@
+package param
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var historyShowSecrets bool
+
+// historyCmd represents the param history command
+var historyCmd = &cobra.Command{
+	Use:   "history <name>",
+	Short: "Show every version of a parameter",
+	Long: `Show every version of a parameter, oldest first, with who changed it,
+when, its labels and its value. SecureString values are hidden unless
+--show-secrets is given.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		history := []types.ParameterHistory{}
+		paginator := ssm.NewGetParameterHistoryPaginator(c.SSM, &ssm.GetParameterHistoryInput{
+			Name:           aws.String(args[0]),
+			WithDecryption: historyShowSecrets,
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(context.TODO())
+			if err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(1)
+			}
+			history = append(history, output.Parameters...)
+		}
+
+		for _, h := range history {
+			modified := ""
+			if h.LastModifiedDate != nil {
+				modified = h.LastModifiedDate.Local().Format("2006-01-02 15:04:05")
+			}
+			labels := ""
+			if len(h.Labels) > 0 {
+				labels = " [" + strings.Join(h.Labels, ", ") + "]"
+			}
+			value := aws.ToString(h.Value)
+			if h.Type == types.ParameterTypeSecureString && !historyShowSecrets {
+				value = "(hidden)"
+			}
+
+			fmt.Println(aurora.Bold(fmt.Sprintf("v%d", h.Version)), modified, aurora.Faint(aws.ToString(h.LastModifiedUser)), aurora.BrightCyan(labels))
+			fmt.Println("   ", value)
+		}
+	},
+}
+
+func init() {
+	paramCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().BoolVar(&historyShowSecrets, "show-secrets", false, "Decrypt and show SecureString values")
+}
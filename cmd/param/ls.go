@@ -0,0 +1,66 @@
+package param
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var lsRecursive bool
+
+// lsCmd represents the param ls command
+var lsCmd = &cobra.Command{
+	Use:   "ls [path]",
+	Short: "List parameters under a path",
+	Long: `List the parameters directly under a path, or everything beneath it
+with --recursive, along with their type, tier, version and when and by
+whom they were last changed. Values aren't read, see param get.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "/"
+		if len(args) == 1 {
+			path = cleanPath(args[0])
+		}
+
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		metadata, err := describeParameters(c, path, lsRecursive)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		if len(metadata) == 0 {
+			fmt.Println(aurora.BrightYellow("No parameters under " + path))
+			return
+		}
+
+		width := 0
+		for _, m := range metadata {
+			if len(aws.ToString(m.Name)) > width {
+				width = len(aws.ToString(m.Name))
+			}
+		}
+		for _, m := range metadata {
+			modified := ""
+			if m.LastModifiedDate != nil {
+				modified = m.LastModifiedDate.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%-*s  %-12s %-12s v%-4d %s  %s\n",
+				width, aws.ToString(m.Name), m.Type, m.Tier, m.Version, modified, aurora.Faint(aws.ToString(m.LastModifiedUser)))
+		}
+	},
+}
+
+func init() {
+	paramCmd.AddCommand(lsCmd)
+
+	lsCmd.Flags().BoolVarP(&lsRecursive, "recursive", "R", false, "List everything beneath the path")
+}
@@ -0,0 +1,159 @@
+package param
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/jjkirkpatrick/awsclihelper/cmd"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/spf13/cobra"
+)
+
+// paramCmd represents the param command
+var paramCmd = &cobra.Command{
+	Use:   "param",
+	Short: "Browse and edit SSM Parameter Store",
+	Long: `List, read, write and compare SSM Parameter Store parameters, or browse
+them as a tree with param browse.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// parameter is a parameter's metadata along with its value.
+type parameter struct {
+	types.ParameterMetadata
+	Value string
+}
+
+func (p parameter) name() string {
+	return aws.ToString(p.Name)
+}
+
+func (p parameter) secure() bool {
+	return p.Type == types.ParameterTypeSecureString
+}
+
+// cleanPath normalises a parameter path, so /app/ and app both become
+// /app. An empty path is the root.
+func cleanPath(path string) string {
+	path = "/" + strings.Trim(path, "/")
+	return path
+}
+
+// relativeName returns a parameter's name relative to path.
+func relativeName(path string, name string) string {
+	if path == "/" {
+		return strings.TrimPrefix(name, "/")
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(name, path), "/")
+}
+
+// describeParameters lists the metadata of the parameters under path, or
+// directly in it unless recursive is set, sorted by name. Any filters are
+// applied too.
+func describeParameters(c *internal.Client, path string, recursive bool, filters ...types.ParameterStringFilter) ([]types.ParameterMetadata, error) {
+	input := &ssm.DescribeParametersInput{ParameterFilters: filters}
+	option := "OneLevel"
+	if recursive {
+		option = "Recursive"
+	}
+	// Names without a leading slash aren't in any path, so the whole
+	// store is listed instead of filtering on the root.
+	if path != "/" || !recursive {
+		input.ParameterFilters = append(input.ParameterFilters, types.ParameterStringFilter{
+			Key:    aws.String("Path"),
+			Option: aws.String(option),
+			Values: []string{path},
+		})
+	}
+
+	metadata := []types.ParameterMetadata{}
+	paginator := ssm.NewDescribeParametersPaginator(c.SSM, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		metadata = append(metadata, output.Parameters...)
+	}
+	sort.Slice(metadata, func(i, j int) bool { return aws.ToString(metadata[i].Name) < aws.ToString(metadata[j].Name) })
+	return metadata, nil
+}
+
+// loadParameters lists the parameters under path along with their values,
+// decrypting SecureStrings.
+func loadParameters(c *internal.Client, path string, recursive bool) ([]parameter, error) {
+	metadata, err := describeParameters(c, path, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	if path != "/" {
+		paginator := ssm.NewGetParametersByPathPaginator(c.SSM, &ssm.GetParametersByPathInput{
+			Path:           aws.String(path),
+			Recursive:      recursive,
+			WithDecryption: true,
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(context.TODO())
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range output.Parameters {
+				values[aws.ToString(p.Name)] = aws.ToString(p.Value)
+			}
+		}
+	}
+
+	missing := []string{}
+	for _, m := range metadata {
+		if _, ok := values[aws.ToString(m.Name)]; !ok {
+			missing = append(missing, aws.ToString(m.Name))
+		}
+	}
+	fetched, err := getParameters(c, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range fetched {
+		values[aws.ToString(p.Name)] = aws.ToString(p.Value)
+	}
+
+	parameters := []parameter{}
+	for _, m := range metadata {
+		parameters = append(parameters, parameter{ParameterMetadata: m, Value: values[aws.ToString(m.Name)]})
+	}
+	return parameters, nil
+}
+
+// getParameters reads parameters by name, decrypting SecureStrings. Names
+// that don't exist are left out.
+func getParameters(c *internal.Client, names []string) ([]types.Parameter, error) {
+	parameters := []types.Parameter{}
+	// GetParameters accepts at most 10 names per call.
+	for i := 0; i < len(names); i += 10 {
+		end := i + 10
+		if end > len(names) {
+			end = len(names)
+		}
+		output, err := c.SSM.GetParameters(context.TODO(), &ssm.GetParametersInput{
+			Names:          names[i:end],
+			WithDecryption: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, output.Parameters...)
+	}
+	return parameters, nil
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(paramCmd)
+}
@@ -0,0 +1,292 @@
+package param
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var syncFrom string
+var syncTo string
+var syncToProfile string
+var syncToRegion string
+var syncToKeyID string
+var syncExclude []string
+var syncDryRun bool
+var syncYes bool
+var syncShowSecrets bool
+
+// noOverwriteTag marks a parameter that sync must leave alone, on either
+// the source or the target side.
+const noOverwriteTag = "overwrite"
+
+// syncCmd represents the param sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync --from <path> --to <path>",
+	Short: "Copy the parameters under one path to another",
+	Long: `Create or update the parameters beneath --to so they match those
+beneath --from, keeping each parameter's type, tier, data type and
+description. The target can be in another account or region with
+--to-profile and --to-region. Parameters only in the target are listed
+but never deleted.
+
+Parameters are skipped when their name relative to the path matches an
+--exclude glob, or when they're tagged overwrite=false on either side.
+
+SecureStrings copied within an account and region keep their KMS key.
+Elsewhere they use the target parameter's existing key, --to-key-id, or
+the target account's default aws/ssm key.
+
+  awsclihelper param sync --from /app/staging --to /app/prod --exclude 'db/*' --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		from, to := cleanPath(syncFrom), cleanPath(syncTo)
+
+		source, err := internal.NewClient()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		target := source
+		if syncToProfile != "" || syncToRegion != "" {
+			if target, err = internal.NewClientFor(syncToProfile, syncToRegion); err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(1)
+			}
+		}
+		if from == to && source.Region == target.Region && *source.Identity.Account == *target.Identity.Account {
+			fmt.Println(aurora.Bold(aurora.BrightRed("--from and --to are the same")))
+			os.Exit(1)
+		}
+
+		fmt.Println(aurora.BrightGreen("Syncing"), aurora.BrightCyan(describeSide(source, from)),
+			aurora.BrightGreen("to"), aurora.BrightCyan(describeSide(target, to)))
+
+		plan, err := planSync(source, from, target, to)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		changed := printPlan(plan)
+		if changed == 0 {
+			fmt.Println(aurora.BrightGreen("Nothing to sync"))
+			return
+		}
+		if syncDryRun {
+			return
+		}
+
+		if !syncYes {
+			confirmation := false
+			prompt := &survey.Confirm{
+				Message: fmt.Sprintf("Write %d parameters to %s?", changed, describeSide(target, to)),
+			}
+			survey.AskOne(prompt, &confirmation)
+			if !confirmation {
+				os.Exit(1)
+			}
+		}
+		if !applySync(source, target, to, plan) {
+			os.Exit(1)
+		}
+	},
+}
+
+type syncAction int
+
+const (
+	syncCreate syncAction = iota
+	syncUpdate
+	syncSkip
+	syncTargetOnly
+)
+
+type syncStep struct {
+	paramChange
+	action syncAction
+	reason string
+}
+
+func describeSide(c *internal.Client, path string) string {
+	side := fmt.Sprintf("%s in %s", path, c.Region)
+	if c.Profile != "" {
+		side += " (" + c.Profile + ")"
+	}
+	return side
+}
+
+// planSync works out what to do for each parameter that differs.
+func planSync(source *internal.Client, from string, target *internal.Client, to string) ([]syncStep, error) {
+	a, err := loadParameters(source, from, true)
+	if err != nil {
+		return nil, err
+	}
+	b, err := loadParameters(target, to, true)
+	if err != nil {
+		return nil, err
+	}
+	sourceMarked, err := markedNoOverwrite(source, from)
+	if err != nil {
+		return nil, err
+	}
+	targetMarked, err := markedNoOverwrite(target, to)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := []syncStep{}
+	for _, change := range diffParameters(from, a, to, b) {
+		step := syncStep{paramChange: change}
+		switch {
+		case change.from == nil:
+			step.action = syncTargetOnly
+		case excluded(change.name) != "":
+			step.action = syncSkip
+			step.reason = "excluded by " + excluded(change.name)
+		case sourceMarked[change.from.name()]:
+			step.action = syncSkip
+			step.reason = "source tagged overwrite=false"
+		case change.to != nil && targetMarked[change.to.name()]:
+			step.action = syncSkip
+			step.reason = "target tagged overwrite=false"
+		case change.to == nil:
+			step.action = syncCreate
+		default:
+			step.action = syncUpdate
+		}
+		plan = append(plan, step)
+	}
+	return plan, nil
+}
+
+// markedNoOverwrite returns the names of parameters under path tagged
+// overwrite=false.
+func markedNoOverwrite(c *internal.Client, path string) (map[string]bool, error) {
+	metadata, err := describeParameters(c, path, true, types.ParameterStringFilter{
+		Key:    aws.String("tag:" + noOverwriteTag),
+		Option: aws.String("Equals"),
+		Values: []string{"false"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	marked := map[string]bool{}
+	for _, m := range metadata {
+		marked[aws.ToString(m.Name)] = true
+	}
+	return marked, nil
+}
+
+// excluded returns the --exclude glob matching a relative name, if any.
+func excluded(name string) string {
+	for _, glob := range syncExclude {
+		if ok, _ := path.Match(glob, name); ok {
+			return glob
+		}
+	}
+	return ""
+}
+
+// printPlan prints the plan, returning how many parameters will be written.
+func printPlan(plan []syncStep) int {
+	show := func(p *parameter) string {
+		if p.secure() && !syncShowSecrets {
+			return "(" + string(p.Type) + ")"
+		}
+		return p.Value
+	}
+
+	changed := 0
+	for _, step := range plan {
+		switch step.action {
+		case syncCreate:
+			changed++
+			fmt.Println(aurora.BrightGreen("+ "+step.name), aurora.Faint(show(step.from)))
+		case syncUpdate:
+			changed++
+			fmt.Println(aurora.BrightYellow("~ " + step.name))
+			if step.from.Type != step.to.Type {
+				fmt.Println(aurora.BrightRed("    - type "+string(step.to.Type)), aurora.BrightGreen("+ type "+string(step.from.Type)))
+			}
+			if step.from.Value != step.to.Value {
+				fmt.Println(aurora.BrightRed("    - " + show(step.to)))
+				fmt.Println(aurora.BrightGreen("    + " + show(step.from)))
+			}
+		case syncSkip:
+			fmt.Println(aurora.Faint("= "+step.name), aurora.Faint("skipped, "+step.reason))
+		case syncTargetOnly:
+			fmt.Println(aurora.Faint("? "+step.name), aurora.Faint("only in target, left alone"))
+		}
+	}
+	return changed
+}
+
+// applySync writes the created and updated parameters, returning false if
+// any failed.
+func applySync(source *internal.Client, target *internal.Client, to string, plan []syncStep) bool {
+	sameAccount := source.Region == target.Region && *source.Identity.Account == *target.Identity.Account
+	ok := true
+
+	for _, step := range plan {
+		if step.action != syncCreate && step.action != syncUpdate {
+			continue
+		}
+		from := step.from
+		input := &ssm.PutParameterInput{
+			Name:        aws.String(joinPath(to, step.name)),
+			Value:       aws.String(from.Value),
+			Type:        from.Type,
+			Tier:        from.Tier,
+			DataType:    from.DataType,
+			Description: from.Description,
+			Overwrite:   step.action == syncUpdate,
+		}
+		if step.to != nil && step.to.Tier == types.ParameterTierAdvanced {
+			// Advanced parameters can't be moved back to the standard tier.
+			input.Tier = types.ParameterTierAdvanced
+		}
+		if from.secure() {
+			switch {
+			case syncToKeyID != "":
+				input.KeyId = aws.String(syncToKeyID)
+			case sameAccount:
+				input.KeyId = from.KeyId
+			case step.to != nil && step.to.secure():
+				input.KeyId = step.to.KeyId
+			}
+		}
+
+		output, err := target.SSM.PutParameter(context.TODO(), input)
+		if err != nil {
+			ok = false
+			fmt.Println(aurora.BrightRed(fmt.Sprintf("Unable to write %s: %s", aws.ToString(input.Name), err)))
+			continue
+		}
+		fmt.Println(aurora.BrightGreen("Wrote"), aurora.BrightCyan(aws.ToString(input.Name)), aurora.Faint(fmt.Sprintf("version %d", output.Version)))
+	}
+	return ok
+}
+
+func init() {
+	paramCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().StringVar(&syncFrom, "from", "", "Path to copy parameters from")
+	syncCmd.Flags().StringVar(&syncTo, "to", "", "Path to copy parameters to")
+	syncCmd.Flags().StringVar(&syncToProfile, "to-profile", "", "Profile for the target (default --profile)")
+	syncCmd.Flags().StringVar(&syncToRegion, "to-region", "", "Region for the target (default --region)")
+	syncCmd.Flags().StringVar(&syncToKeyID, "to-key-id", "", "KMS key for SecureStrings written to the target")
+	syncCmd.Flags().StringSliceVarP(&syncExclude, "exclude", "x", nil, "Globs of names relative to the path to skip, e.g. 'db/*'")
+	syncCmd.Flags().BoolVarP(&syncDryRun, "dry-run", "n", false, "Only show what would change")
+	syncCmd.Flags().BoolVarP(&syncYes, "yes", "y", false, "Don't ask for confirmation")
+	syncCmd.Flags().BoolVar(&syncShowSecrets, "show-secrets", false, "Show SecureString values that differ")
+	syncCmd.MarkFlagRequired("from")
+	syncCmd.MarkFlagRequired("to")
+}
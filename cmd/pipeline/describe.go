@@ -0,0 +1,206 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var describeFormat string
+
+// describeCmd represents the pipeline describe command
+var describeCmd = &cobra.Command{
+	Use:   "describe [pipeline]",
+	Short: "Print a pipeline's definition as YAML or JSON",
+	Long: `Print a pipeline's stages, actions and settings as returned by
+GetPipeline, in YAML or JSON. Without a pipeline name you're asked to
+choose one.
+
+  awsclihelper pipeline describe my-app -o json > my-app.json`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var c *internal.Client
+		name := ""
+		if len(args) == 1 {
+			client, err := internal.NewClient()
+			if err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(1)
+			}
+			c, name = client, args[0]
+		} else {
+			clients, err := internal.NewClients()
+			if err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(1)
+			}
+			if name, c = getPipelineToMonitor(clients); name == "" {
+				os.Exit(1)
+			}
+		}
+
+		output, err := getPipeline(c, name)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		data, err := encodeDocument(plain(reflect.ValueOf(output)), describeFormat)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		fmt.Print(string(data))
+	},
+}
+
+// pipelineDefinition is the part of GetPipeline's output that's printed.
+type pipelineDefinition struct {
+	Pipeline interface{}
+	Metadata interface{}
+}
+
+func getPipeline(c *internal.Client, name string) (pipelineDefinition, error) {
+	output, err := c.PIPELINE.GetPipeline(context.TODO(), &codepipeline.GetPipelineInput{Name: aws.String(name)})
+	if err != nil {
+		return pipelineDefinition{}, fmt.Errorf("unable to get pipeline %s: %w", name, err)
+	}
+	return pipelineDefinition{Pipeline: output.Pipeline, Metadata: output.Metadata}, nil
+}
+
+// field is a key and its value in a document.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// document is an object that keeps its keys in order when encoded as JSON
+// or YAML.
+type document []field
+
+func (d document) get(key string) interface{} {
+	for _, f := range d {
+		if f.key == key {
+			return f.value
+		}
+	}
+	return nil
+}
+
+func (d document) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range d {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (d document) MarshalYAML() (interface{}, error) {
+	items := yaml.MapSlice{}
+	for _, f := range d {
+		items = append(items, yaml.MapItem{Key: f.key, Value: f.value})
+	}
+	return items, nil
+}
+
+// plain turns an SDK value into documents, slices and scalars, naming
+// fields as the AWS CLI does and leaving out those that are empty.
+func plain(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return plain(v.Elem())
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t.Format(time.RFC3339)
+		}
+		d := document{}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if value := plain(v.Field(i)); value != nil {
+				d = append(d, field{strings.ToLower(f.Name[:1]) + f.Name[1:], value})
+			}
+		}
+		return d
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return nil
+		}
+		items := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, plain(v.Index(i)))
+		}
+		return items
+	case reflect.Map:
+		if v.Len() == 0 {
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		d := document{}
+		for _, k := range keys {
+			d = append(d, field{k.String(), plain(v.MapIndex(k))})
+		}
+		return d
+	case reflect.String:
+		if v.Len() == 0 {
+			return nil
+		}
+		return v.String()
+	default:
+		return v.Interface()
+	}
+}
+
+func encodeDocument(value interface{}, format string) ([]byte, error) {
+	switch format {
+	case "yaml":
+		return yaml.Marshal(value)
+	case "json":
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unknown format %s, use yaml or json", format)
+	}
+}
+
+func init() {
+	pipelineCmd.AddCommand(describeCmd)
+
+	describeCmd.Flags().StringVarP(&describeFormat, "output", "o", "yaml", "Output format: yaml or json")
+}
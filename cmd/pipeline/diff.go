@@ -0,0 +1,192 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var diffProfileB string
+var diffRegionB string
+
+// diffCmd represents the pipeline diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <pipeline-a> <pipeline-b>",
+	Short: "Compare the structure and configuration of two pipelines",
+	Long: `Compare two pipelines' stages, actions and configuration, matching
+stages and actions by name. The pipelines' names and versions are ignored,
+and every ARN, such as a role or KMS key, and the account IDs in ECR and
+S3 URIs are masked, so a staging and production pipeline built from the
+same template in different accounts only differ where their settings do.
+The command exits 1 if the pipelines differ.
+
+The second pipeline is read with --profile-b and --region-b if given, so
+pipelines in different accounts or regions can be compared.
+
+  awsclihelper pipeline diff my-app-staging my-app-prod
+  awsclihelper pipeline diff --profile staging --profile-b prod my-app my-app`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		cb := c
+		if diffProfileB != "" || diffRegionB != "" {
+			if cb, err = internal.NewClientFor(diffProfileB, diffRegionB); err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(1)
+			}
+		}
+
+		a, err := getPipeline(c, args[0])
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		b, err := getPipeline(cb, args[1])
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		from, to := flattenPipeline(a), flattenPipeline(b)
+		if printFlatDiff(from, to) {
+			os.Exit(1)
+		}
+		fmt.Println(aurora.BrightGreen(fmt.Sprintf("%s and %s are the same", args[0], args[1])))
+	},
+}
+
+// flatDocument is a document flattened to paths such as
+// stages[Build].actions[Compile].configuration.ProjectName, in the order
+// they appear.
+type flatDocument struct {
+	paths  []string
+	values map[string]string
+}
+
+func (f *flatDocument) add(path string, value string) {
+	f.paths = append(f.paths, path)
+	f.values[path] = value
+}
+
+// flattenPipeline flattens a pipeline's declaration, leaving out what
+// differs between copies of the same pipeline.
+func flattenPipeline(p pipelineDefinition) *flatDocument {
+	flat := &flatDocument{values: map[string]string{}}
+	declaration, _ := plain(reflect.ValueOf(p.Pipeline)).(document)
+	for _, f := range declaration {
+		if f.key == "name" || f.key == "version" {
+			continue
+		}
+		flatten(f.key, f.value, flat)
+	}
+	return flat
+}
+
+// ARNs in any partition, and the account IDs in ECR image and S3 URIs,
+// are masked wherever they appear, as they name account specific
+// resources.
+var (
+	arnValue     = regexp.MustCompile(`arn:aws[a-z-]*:[^"\s,]*`)
+	ecrAccountID = regexp.MustCompile(`\b[0-9]{12}(\.dkr\.ecr\.)`)
+	s3URI        = regexp.MustCompile(`s3://[^"\s,]*`)
+	accountID    = regexp.MustCompile(`\b[0-9]{12}\b`)
+)
+
+const (
+	maskedArn       = "<arn>"
+	maskedAccountID = "<account>"
+)
+
+// maskAccount masks ARNs and account IDs in a value.
+func maskAccount(text string) string {
+	text = arnValue.ReplaceAllString(text, maskedArn)
+	text = ecrAccountID.ReplaceAllString(text, maskedAccountID+"$1")
+	return s3URI.ReplaceAllStringFunc(text, func(uri string) string {
+		return accountID.ReplaceAllString(uri, maskedAccountID)
+	})
+}
+
+func flatten(path string, value interface{}, flat *flatDocument) {
+	switch v := value.(type) {
+	case document:
+		for _, f := range v {
+			flatten(path+"."+f.key, f.value, flat)
+		}
+	case []interface{}:
+		names := []string{}
+		for _, item := range v {
+			if d, ok := item.(document); ok {
+				if name, ok := d.get("name").(string); ok {
+					names = append(names, name)
+				}
+			}
+		}
+		if len(names) != len(v) {
+			for i, item := range v {
+				flatten(fmt.Sprintf("%s[%d]", path, i), item, flat)
+			}
+			return
+		}
+		// Lists of named things are compared by name, with their order
+		// compared separately.
+		flat.add(path, "["+strings.Join(names, ", ")+"]")
+		for i, item := range v {
+			for _, f := range item.(document) {
+				if f.key != "name" {
+					flatten(fmt.Sprintf("%s[%s].%s", path, names[i], f.key), f.value, flat)
+				}
+			}
+		}
+	default:
+		flat.add(path, maskAccount(fmt.Sprint(v)))
+	}
+}
+
+// printFlatDiff prints - for paths only in from, + for those only in to and
+// ~ for those in both that differ, returning false if there were none.
+func printFlatDiff(from *flatDocument, to *flatDocument) bool {
+	paths := append([]string{}, from.paths...)
+	for _, path := range to.paths {
+		if _, ok := from.values[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+
+	changed := false
+	for _, path := range paths {
+		a, inFrom := from.values[path]
+		b, inTo := to.values[path]
+		switch {
+		case !inTo:
+			fmt.Println(aurora.BrightRed("- "+path), aurora.Faint(a))
+		case !inFrom:
+			fmt.Println(aurora.BrightGreen("+ "+path), aurora.Faint(b))
+		case a != b:
+			fmt.Println(aurora.BrightYellow("~ " + path))
+			fmt.Println(aurora.BrightRed("    - " + a))
+			fmt.Println(aurora.BrightGreen("    + " + b))
+		default:
+			continue
+		}
+		changed = true
+	}
+	return changed
+}
+
+func init() {
+	pipelineCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVar(&diffProfileB, "profile-b", "", "Profile to read the second pipeline with (default --profile)")
+	diffCmd.Flags().StringVar(&diffRegionB, "region-b", "", "Region to read the second pipeline from (default --region)")
+}
@@ -0,0 +1,182 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+)
+
+// failedAction is what's known about an action that failed in the
+// execution being monitored.
+type failedAction struct {
+	stage    string
+	action   string
+	provider string
+	code     string
+	message  string
+	summary  string
+	url      string
+	buildID  string
+	logURL   string
+}
+
+// failedActions finds the failed actions of the current execution, filling
+// in the execution summary and CodeBuild details from ListActionExecutions.
+func failedActions(e *pipelineStatus, c *internal.Client) ([]failedAction, error) {
+	executionID := aws.ToString(e.latestExecution[0].PipelineExecutionId)
+
+	failed := []failedAction{}
+	for _, stage := range e.pipelineStageStates {
+		if stage.LatestExecution == nil || aws.ToString(stage.LatestExecution.PipelineExecutionId) != executionID {
+			continue
+		}
+		for _, action := range stage.ActionStates {
+			if action.LatestExecution == nil || action.LatestExecution.Status != types.ActionExecutionStatusFailed {
+				continue
+			}
+			f := failedAction{
+				stage:   aws.ToString(stage.StageName),
+				action:  aws.ToString(action.ActionName),
+				summary: aws.ToString(action.LatestExecution.Summary),
+				url:     aws.ToString(action.LatestExecution.ExternalExecutionUrl),
+			}
+			if details := action.LatestExecution.ErrorDetails; details != nil {
+				f.code = aws.ToString(details.Code)
+				f.message = aws.ToString(details.Message)
+			}
+			failed = append(failed, f)
+		}
+	}
+	if len(failed) == 0 {
+		return failed, nil
+	}
+
+	paginator := codepipeline.NewListActionExecutionsPaginator(c.PIPELINE, &codepipeline.ListActionExecutionsInput{
+		PipelineName: aws.String(e.pipeline),
+		Filter:       &types.ActionExecutionFilter{PipelineExecutionId: aws.String(executionID)},
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return failed, err
+		}
+		for _, detail := range output.ActionExecutionDetails {
+			for i := range failed {
+				if failed[i].stage == aws.ToString(detail.StageName) && failed[i].action == aws.ToString(detail.ActionName) {
+					failed[i].addDetail(c, detail)
+				}
+			}
+		}
+	}
+	return failed, nil
+}
+
+// addDetail fills in what ListActionExecutions knows about the action.
+// Executions are listed newest first, so the first one seen wins.
+func (f *failedAction) addDetail(c *internal.Client, detail types.ActionExecutionDetail) {
+	if f.provider != "" {
+		return
+	}
+	if detail.Input != nil && detail.Input.ActionTypeId != nil {
+		f.provider = aws.ToString(detail.Input.ActionTypeId.Provider)
+	}
+	if detail.Output == nil || detail.Output.ExecutionResult == nil {
+		return
+	}
+	result := detail.Output.ExecutionResult
+	if summary := aws.ToString(result.ExternalExecutionSummary); summary != "" {
+		f.summary = summary
+	}
+	if link := aws.ToString(result.ExternalExecutionUrl); link != "" {
+		f.url = link
+	}
+	// CodeBuild's external execution ID is the build ID, project:uuid.
+	if f.provider == "CodeBuild" && result.ExternalExecutionId != nil {
+		f.buildID = aws.ToString(result.ExternalExecutionId)
+		f.logURL = codeBuildLogURL(c, f.buildID)
+	}
+}
+
+// codeBuildLogURL links to a build's log in the CodeBuild console.
+func codeBuildLogURL(c *internal.Client, buildID string) string {
+	project := buildID
+	if i := strings.Index(buildID, ":"); i != -1 {
+		project = buildID[:i]
+	}
+	return fmt.Sprintf("https://%s.console.aws.amazon.com/codesuite/codebuild/%s/projects/%s/build/%s/log?region=%s",
+		c.Region, aws.ToString(c.Identity.Account), url.PathEscape(project), url.PathEscape(buildID), c.Region)
+}
+
+// failureLines describes the failed actions for the status screen.
+func failureLines(failed []failedAction) []line {
+	lines := []line{}
+	detail := func(label string, value string, colour func(arg interface{}) aurora.Value) {
+		if value != "" {
+			lines = append(lines, line{fmt.Sprintf("    %-10s%s", label, value), colour})
+		}
+	}
+	for _, f := range failed {
+		lines = append(lines, line{fmt.Sprintf("Action %s in stage %s has failed", f.action, f.stage), aurora.BrightRed})
+		detail("Provider", f.provider, nil)
+		detail("Error", strings.TrimSpace(f.code+" "+f.message), aurora.BrightRed)
+		detail("Summary", f.summary, nil)
+		detail("Build", f.buildID, aurora.Cyan)
+		detail("Logs", f.logURL, aurora.Cyan)
+		detail("Details", f.url, aurora.Cyan)
+	}
+	return lines
+}
+
+// link returns the most useful link for a failed action, the build log if
+// there is one.
+func (f failedAction) link() string {
+	if f.logURL != "" {
+		return f.logURL
+	}
+	return f.url
+}
+
+// retryFailedStages retries the failed actions in each stage that failed,
+// returning the stages retried.
+func retryFailedStages(e *pipelineStatus, c *internal.Client, failed []failedAction) ([]string, error) {
+	retried := []string{}
+	seen := map[string]bool{}
+	for _, f := range failed {
+		if seen[f.stage] {
+			continue
+		}
+		seen[f.stage] = true
+		_, err := c.PIPELINE.RetryStageExecution(context.TODO(), &codepipeline.RetryStageExecutionInput{
+			PipelineName:        aws.String(e.pipeline),
+			StageName:           aws.String(f.stage),
+			PipelineExecutionId: e.latestExecution[0].PipelineExecutionId,
+			RetryMode:           types.StageRetryModeFailedActions,
+		})
+		if err != nil {
+			return retried, fmt.Errorf("unable to retry stage %s: %w", f.stage, err)
+		}
+		retried = append(retried, f.stage)
+	}
+	return retried, nil
+}
+
+// openURL opens a link in the default browser.
+func openURL(link string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", link).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", link).Start()
+	default:
+		return exec.Command("xdg-open", link).Start()
+	}
+}
@@ -0,0 +1,322 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var lintRulesFile string
+
+// The patterns used by the default rules, and by rules in a rules file
+// that leave them out.
+const (
+	defaultStagesPattern = `(?i)^prod`
+	defaultKeysPattern   = `(?i)(password|passwd|secret|token|api_?key|private_?key)`
+	defaultAllowPattern  = `^(\*+|\{\{resolve:.*\}\}|#\{.*\}|arn:aws[a-z-]*:(secretsmanager|ssm):.*)$`
+)
+
+// defaultLintRules is used when no --rules file is given, and shows the
+// rules file format.
+const defaultLintRules = `rules:
+  # Stages whose names match stages must start with a manual approval.
+  - name: prod-approval-first
+    type: approval-first
+    stages: '` + defaultStagesPattern + `'
+
+  # Action configuration keys, and CodeBuild plaintext environment
+  # variables, whose names match keys must have values matching allow.
+  - name: no-plaintext-secrets
+    type: no-plaintext-secrets
+    keys: '` + defaultKeysPattern + `'
+    allow: '` + defaultAllowPattern + `'
+
+  # Artifact stores must be encrypted with a KMS key.
+  - name: artifact-store-encrypted
+    type: artifact-store-encrypted
+    severity: warning
+`
+
+// lintRule is one rule in a rules file. Severity is error, the default,
+// or warning.
+type lintRule struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Severity string `yaml:"severity"`
+	Stages   string `yaml:"stages"`
+	Keys     string `yaml:"keys"`
+	Allow    string `yaml:"allow"`
+
+	stages *regexp.Regexp
+	keys   *regexp.Regexp
+	allow  *regexp.Regexp
+	check  func(r lintRule, p *types.PipelineDeclaration) []string
+}
+
+type lintRules struct {
+	Rules []lintRule `yaml:"rules"`
+}
+
+// lintCmd represents the pipeline lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint [pipeline...]",
+	Short: "Check pipelines against a set of rules",
+	Long: `Check pipelines, or every pipeline in the region, against a set of
+rules, exiting 1 if any rule with severity error is broken. The rules are
+read from a YAML file given with --rules, by default:
+
+` + defaultLintRules,
+	Run: func(cmd *cobra.Command, args []string) {
+		rules, err := loadLintRules(lintRulesFile)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		names := args
+		if len(names) == 0 {
+			if names, err = listPipelineNames(c); err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(1)
+			}
+		}
+
+		errors := 0
+		for _, name := range names {
+			output, err := c.PIPELINE.GetPipeline(context.TODO(), &codepipeline.GetPipelineInput{Name: aws.String(name)})
+			if err != nil {
+				fmt.Println(aurora.BrightRed(fmt.Sprintf("Unable to get pipeline %s: %s", name, err)))
+				errors++
+				continue
+			}
+			errors += lintPipeline(name, output.Pipeline, rules)
+		}
+		if errors > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// loadLintRules reads a rules file, or the default rules if path is empty.
+func loadLintRules(path string) ([]lintRule, error) {
+	data := []byte(defaultLintRules)
+	if path != "" {
+		var err error
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	config := lintRules{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %w", path, err)
+	}
+
+	for i := range config.Rules {
+		r := &config.Rules[i]
+		if r.Name == "" {
+			r.Name = r.Type
+		}
+		if r.Severity == "" {
+			r.Severity = "error"
+		}
+		if r.Severity != "error" && r.Severity != "warning" {
+			return nil, fmt.Errorf("rule %s: unknown severity %s, use error or warning", r.Name, r.Severity)
+		}
+
+		var err error
+		switch r.Type {
+		case "approval-first":
+			r.check = checkApprovalFirst
+			r.stages, err = compileRulePattern(r.Stages, defaultStagesPattern)
+		case "no-plaintext-secrets":
+			r.check = checkPlaintextSecrets
+			if r.keys, err = compileRulePattern(r.Keys, defaultKeysPattern); err == nil {
+				r.allow, err = compileRulePattern(r.Allow, defaultAllowPattern)
+			}
+		case "artifact-store-encrypted":
+			r.check = checkArtifactStoreEncrypted
+		default:
+			return nil, fmt.Errorf("rule %s: unknown type %q, use approval-first, no-plaintext-secrets or artifact-store-encrypted", r.Name, r.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+	return config.Rules, nil
+}
+
+func compileRulePattern(pattern string, fallback string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = fallback
+	}
+	return regexp.Compile(pattern)
+}
+
+func listPipelineNames(c *internal.Client) ([]string, error) {
+	names := []string{}
+	paginator := codepipeline.NewListPipelinesPaginator(c.PIPELINE, &codepipeline.ListPipelinesInput{})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range output.Pipelines {
+			names = append(names, aws.ToString(p.Name))
+		}
+	}
+	return names, nil
+}
+
+// lintPipeline prints the rules a pipeline breaks, returning how many of
+// them are errors.
+func lintPipeline(name string, p *types.PipelineDeclaration, rules []lintRule) int {
+	errors := 0
+	clean := true
+	for _, r := range rules {
+		for _, problem := range r.check(r, p) {
+			clean = false
+			if r.Severity == "error" {
+				errors++
+				fmt.Println(aurora.BrightRed("error  "), aurora.BrightCyan(name), aurora.Faint(r.Name), problem)
+			} else {
+				fmt.Println(aurora.BrightYellow("warning"), aurora.BrightCyan(name), aurora.Faint(r.Name), problem)
+			}
+		}
+	}
+	if clean {
+		fmt.Println(aurora.BrightGreen("ok     "), aurora.BrightCyan(name))
+	}
+	return errors
+}
+
+func runOrder(a types.ActionDeclaration) int32 {
+	if a.RunOrder == nil {
+		return 1
+	}
+	return *a.RunOrder
+}
+
+// checkApprovalFirst requires matching stages to start with a manual
+// approval that every other action in the stage runs after.
+func checkApprovalFirst(r lintRule, p *types.PipelineDeclaration) []string {
+	problems := []string{}
+	for _, stage := range p.Stages {
+		name := aws.ToString(stage.Name)
+		if !r.stages.MatchString(name) {
+			continue
+		}
+
+		approval := int32(-1)
+		for _, action := range stage.Actions {
+			if action.ActionTypeId != nil && action.ActionTypeId.Category == types.ActionCategoryApproval {
+				if approval == -1 || runOrder(action) < approval {
+					approval = runOrder(action)
+				}
+			}
+		}
+		if approval == -1 {
+			problems = append(problems, fmt.Sprintf("stage %s has no manual approval", name))
+			continue
+		}
+		for _, action := range stage.Actions {
+			if action.ActionTypeId != nil && action.ActionTypeId.Category != types.ActionCategoryApproval && runOrder(action) <= approval {
+				problems = append(problems, fmt.Sprintf("action %s in stage %s runs before or alongside the manual approval", aws.ToString(action.Name), name))
+			}
+		}
+	}
+	return problems
+}
+
+// checkPlaintextSecrets looks for secrets in action configuration,
+// including CodeBuild environment variables of type PLAINTEXT.
+func checkPlaintextSecrets(r lintRule, p *types.PipelineDeclaration) []string {
+	problems := []string{}
+	for _, stage := range p.Stages {
+		for _, action := range stage.Actions {
+			where := fmt.Sprintf("action %s in stage %s", aws.ToString(action.Name), aws.ToString(stage.Name))
+
+			keys := []string{}
+			for k := range action.Configuration {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				v := action.Configuration[k]
+				if v != "" && r.keys.MatchString(k) && !r.allow.MatchString(v) {
+					problems = append(problems, fmt.Sprintf("%s has %s in plain text", where, k))
+				}
+			}
+
+			variables := []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+				Type  string `json:"type"`
+			}{}
+			if json.Unmarshal([]byte(action.Configuration["EnvironmentVariables"]), &variables) != nil {
+				continue
+			}
+			for _, v := range variables {
+				if (v.Type == "" || v.Type == "PLAINTEXT") && v.Value != "" && r.keys.MatchString(v.Name) && !r.allow.MatchString(v.Value) {
+					problems = append(problems, fmt.Sprintf("%s has environment variable %s in plain text, use type PARAMETER_STORE or SECRETS_MANAGER", where, v.Name))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// checkArtifactStoreEncrypted requires every artifact store to have a KMS
+// key.
+func checkArtifactStoreEncrypted(r lintRule, p *types.PipelineDeclaration) []string {
+	stores := map[string]types.ArtifactStore{}
+	if p.ArtifactStore != nil {
+		stores[""] = *p.ArtifactStore
+	}
+	for region, store := range p.ArtifactStores {
+		stores[region] = store
+	}
+
+	regions := []string{}
+	for region := range stores {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	problems := []string{}
+	for _, region := range regions {
+		store := stores[region]
+		if store.EncryptionKey != nil && aws.ToString(store.EncryptionKey.Id) != "" {
+			continue
+		}
+		where := "artifact store " + aws.ToString(store.Location)
+		if region != "" {
+			where += " in " + region
+		}
+		problems = append(problems, where+" isn't encrypted with a KMS key")
+	}
+	return problems
+}
+
+func init() {
+	pipelineCmd.AddCommand(lintCmd)
+
+	lintCmd.Flags().StringVar(&lintRulesFile, "rules", "", "YAML file of rules to check (default the rules above)")
+}
@@ -0,0 +1,243 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+	"github.com/spf13/viper"
+)
+
+// completion describes a finished pipeline execution for notifiers.
+type completion struct {
+	Pipeline    string        `json:"pipeline"`
+	ExecutionID string        `json:"executionId"`
+	Status      string        `json:"status"`
+	Duration    time.Duration `json:"-"`
+	FailedStage string        `json:"failedStage,omitempty"`
+}
+
+// title is a one line description of the completion.
+func (n completion) title() string {
+	return fmt.Sprintf("Pipeline %s %s", n.Pipeline, strings.ToLower(n.Status))
+}
+
+// text is a longer description of the completion.
+func (n completion) text() string {
+	text := fmt.Sprintf("Execution %s finished with status %s after %s", n.ExecutionID, n.Status, n.Duration.Round(time.Second))
+	if n.FailedStage != "" {
+		text += fmt.Sprintf(", stage %s failed", n.FailedStage)
+	}
+	return text
+}
+
+// notifier tells someone a pipeline execution has finished.
+type notifier interface {
+	notify(ctx context.Context, n completion) error
+}
+
+// notifierConfig is one entry in the notifications config, e.g.
+//
+//	notifications:
+//	  - type: bell
+//	  - type: desktop
+//	  - type: webhook
+//	    url: https://example.com/hooks/pipelines
+//	    headers:
+//	      Authorization: Bearer abc123
+//	  - type: slack
+//	    url: https://hooks.slack.com/services/...
+type notifierConfig struct {
+	Type    string            `mapstructure:"type"`
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+// newNotifier creates the notifier a config entry describes.
+func newNotifier(config notifierConfig) (notifier, error) {
+	switch config.Type {
+	case "bell":
+		return bellNotifier{out: os.Stderr}, nil
+	case "desktop":
+		return desktopNotifier{}, nil
+	case "webhook", "slack":
+		if config.URL == "" {
+			return nil, fmt.Errorf("%s notifier needs a url", config.Type)
+		}
+		webhook := &webhookNotifier{url: config.URL, headers: config.Headers, client: http.DefaultClient}
+		if config.Type == "slack" {
+			webhook.payload = slackPayload
+		}
+		return webhook, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q, use bell, desktop, webhook or slack", config.Type)
+	}
+}
+
+// configuredNotifiers reads the notifiers from the notifications config,
+// returning errors for any that are invalid alongside those that aren't.
+func configuredNotifiers() ([]notifier, []error) {
+	configs := []notifierConfig{}
+	if err := viper.UnmarshalKey("notifications", &configs); err != nil {
+		return nil, []error{fmt.Errorf("invalid notifications config: %w", err)}
+	}
+
+	notifiers := []notifier{}
+	errs := []error{}
+	for _, config := range configs {
+		n, err := newNotifier(config)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, errs
+}
+
+// notifyCompletion sends the execution's result to every configured
+// notifier, returning any that failed. A failure doesn't stop the others.
+func notifyCompletion(e *pipelineStatus, status types.PipelineExecutionStatus) []error {
+	notifiers, errs := configuredNotifiers()
+	if len(notifiers) == 0 {
+		return errs
+	}
+
+	n := completion{
+		Pipeline:    e.pipeline,
+		ExecutionID: aws.ToString(e.latestExecution[0].PipelineExecutionId),
+		Status:      string(status),
+		FailedStage: failedStage(e),
+	}
+	if start := e.latestExecution[0].StartTime; start != nil {
+		n.Duration = time.Since(*start)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, notifier := range notifiers {
+		if err := notifier.notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// failedStage returns the first stage that failed in the execution being
+// monitored, if any.
+func failedStage(e *pipelineStatus) string {
+	executionID := aws.ToString(e.latestExecution[0].PipelineExecutionId)
+	for _, stage := range e.pipelineStageStates {
+		if stage.LatestExecution != nil && aws.ToString(stage.LatestExecution.PipelineExecutionId) == executionID &&
+			stage.LatestExecution.Status == types.StageExecutionStatusFailed {
+			return aws.ToString(stage.StageName)
+		}
+	}
+	return ""
+}
+
+// bellNotifier rings the terminal bell. It writes to stderr so the bell
+// doesn't end up in piped or redirected output.
+type bellNotifier struct {
+	out io.Writer
+}
+
+func (b bellNotifier) notify(ctx context.Context, n completion) error {
+	_, err := fmt.Fprint(b.out, "\a")
+	return err
+}
+
+// desktopNotifier shows an OS desktop notification.
+type desktopNotifier struct{}
+
+func (desktopNotifier) notify(ctx context.Context, n completion) error {
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", n.text(), n.title())
+		return exec.CommandContext(ctx, "osascript", "-e", script).Run()
+	case "linux":
+		return exec.CommandContext(ctx, "notify-send", n.title(), n.text()).Run()
+	default:
+		return fmt.Errorf("desktop notifications aren't supported on %s", runtime.GOOS)
+	}
+}
+
+// webhookNotifier POSTs the completion as JSON to a URL. By default the
+// body is the completion itself, with the duration in seconds.
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	payload func(n completion) interface{}
+}
+
+func (w *webhookNotifier) notify(ctx context.Context, n completion) error {
+	payload := w.payload
+	if payload == nil {
+		payload = webhookPayload
+	}
+	body, err := json.Marshal(payload(n))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", w.url, resp.Status)
+	}
+	return nil
+}
+
+func webhookPayload(n completion) interface{} {
+	return struct {
+		completion
+		Duration int64 `json:"durationSeconds"`
+	}{n, int64(n.Duration.Seconds())}
+}
+
+// slackPayload formats the completion for a Slack compatible incoming
+// webhook.
+func slackPayload(n completion) interface{} {
+	colour := "danger"
+	if n.Status == string(types.PipelineExecutionStatusSucceeded) {
+		colour = "good"
+	}
+	fields := []map[string]interface{}{
+		{"title": "Pipeline", "value": n.Pipeline, "short": true},
+		{"title": "Status", "value": n.Status, "short": true},
+		{"title": "Execution", "value": n.ExecutionID, "short": true},
+		{"title": "Duration", "value": n.Duration.Round(time.Second).String(), "short": true},
+	}
+	if n.FailedStage != "" {
+		fields = append(fields, map[string]interface{}{"title": "Failed stage", "value": n.FailedStage, "short": true})
+	}
+	return map[string]interface{}{
+		"text": n.title(),
+		"attachments": []map[string]interface{}{
+			{"color": colour, "fallback": n.text(), "fields": fields},
+		},
+	}
+}
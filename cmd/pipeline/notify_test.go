@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// received is a request captured by a test webhook server.
+type received struct {
+	header http.Header
+	body   map[string]interface{}
+}
+
+// webhookServer records each request and replies with status.
+func webhookServer(t *testing.T, status int) (*httptest.Server, <-chan received) {
+	t.Helper()
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body := map[string]interface{}{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("body %s isn't a JSON object: %v", data, err)
+		}
+		requests <- received{header: r.Header, body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+var failedCompletion = completion{
+	Pipeline:    "my-app",
+	ExecutionID: "abc-123",
+	Status:      "Failed",
+	Duration:    90*time.Second + 400*time.Millisecond,
+	FailedStage: "Deploy",
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server, requests := webhookServer(t, http.StatusNoContent)
+	n, err := newNotifier(notifierConfig{
+		Type:    "webhook",
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer abc123", "X-Source": "awsclihelper"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.notify(context.Background(), failedCompletion); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-requests
+	want := map[string]interface{}{
+		"pipeline":        "my-app",
+		"executionId":     "abc-123",
+		"status":          "Failed",
+		"durationSeconds": float64(90),
+		"failedStage":     "Deploy",
+	}
+	for k, v := range want {
+		if r.body[k] != v {
+			t.Errorf("body %s = %v, want %v", k, r.body[k], v)
+		}
+	}
+	if len(r.body) != len(want) {
+		t.Errorf("body has fields %v, want only %v", r.body, want)
+	}
+
+	if got := r.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if got := r.header.Get("Authorization"); got != "Bearer abc123" {
+		t.Errorf("Authorization = %q, want Bearer abc123", got)
+	}
+	if got := r.header.Get("X-Source"); got != "awsclihelper" {
+		t.Errorf("X-Source = %q, want awsclihelper", got)
+	}
+}
+
+func TestWebhookNotifierOmitsFailedStage(t *testing.T) {
+	server, requests := webhookServer(t, http.StatusOK)
+	n, err := newNotifier(notifierConfig{Type: "webhook", URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	succeeded := completion{Pipeline: "my-app", ExecutionID: "abc-123", Status: "Succeeded"}
+	if err := n.notify(context.Background(), succeeded); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-requests; r.body["failedStage"] != nil {
+		t.Errorf("failedStage = %v, want it left out", r.body["failedStage"])
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	tests := []struct {
+		n      completion
+		colour string
+		fields map[string]string
+	}{
+		{
+			n:      failedCompletion,
+			colour: "danger",
+			fields: map[string]string{
+				"Pipeline":     "my-app",
+				"Status":       "Failed",
+				"Execution":    "abc-123",
+				"Duration":     "1m30s",
+				"Failed stage": "Deploy",
+			},
+		},
+		{
+			n:      completion{Pipeline: "my-app", ExecutionID: "def-456", Status: "Succeeded", Duration: time.Minute},
+			colour: "good",
+			fields: map[string]string{
+				"Pipeline":  "my-app",
+				"Status":    "Succeeded",
+				"Execution": "def-456",
+				"Duration":  "1m0s",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		server, requests := webhookServer(t, http.StatusOK)
+		n, err := newNotifier(notifierConfig{Type: "slack", URL: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := n.notify(context.Background(), tt.n); err != nil {
+			t.Fatal(err)
+		}
+
+		r := <-requests
+		if r.body["text"] != tt.n.title() {
+			t.Errorf("text = %v, want %q", r.body["text"], tt.n.title())
+		}
+		attachments, ok := r.body["attachments"].([]interface{})
+		if !ok || len(attachments) != 1 {
+			t.Fatalf("attachments = %v, want one attachment", r.body["attachments"])
+		}
+		attachment := attachments[0].(map[string]interface{})
+		if attachment["color"] != tt.colour {
+			t.Errorf("color = %v, want %s", attachment["color"], tt.colour)
+		}
+		if attachment["fallback"] != tt.n.text() {
+			t.Errorf("fallback = %v, want %q", attachment["fallback"], tt.n.text())
+		}
+
+		fields := attachment["fields"].([]interface{})
+		if len(fields) != len(tt.fields) {
+			t.Errorf("got %d fields, want %d", len(fields), len(tt.fields))
+		}
+		for _, f := range fields {
+			field := f.(map[string]interface{})
+			title, _ := field["title"].(string)
+			if want, ok := tt.fields[title]; !ok || field["value"] != want {
+				t.Errorf("field %s = %v, want %q", title, field["value"], want)
+			}
+			if field["short"] != true {
+				t.Errorf("field %s isn't short", title)
+			}
+		}
+	}
+}
+
+func TestWebhookNotifierErrorStatus(t *testing.T) {
+	for _, status := range []int{http.StatusMovedPermanently, http.StatusBadRequest, http.StatusInternalServerError} {
+		server, requests := webhookServer(t, status)
+		n, err := newNotifier(notifierConfig{Type: "webhook", URL: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = n.notify(context.Background(), failedCompletion)
+		<-requests
+		if err == nil {
+			t.Errorf("status %d: got no error", status)
+		} else if !strings.Contains(err.Error(), server.URL) {
+			t.Errorf("status %d: error %q doesn't name the webhook", status, err)
+		}
+	}
+}
+
+func TestNewNotifierErrors(t *testing.T) {
+	for _, config := range []notifierConfig{
+		{Type: "webhook"},
+		{Type: "slack"},
+		{Type: "email", URL: "mailto:someone@example.com"},
+	} {
+		if _, err := newNotifier(config); err == nil {
+			t.Errorf("%+v: got no error", config)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+	"github.com/aws/smithy-go"
+)
+
+// pipelineAPI is the part of the CodePipeline client the poller uses.
+type pipelineAPI interface {
+	ListPipelineExecutions(ctx context.Context, params *codepipeline.ListPipelineExecutionsInput, optFns ...func(*codepipeline.Options)) (*codepipeline.ListPipelineExecutionsOutput, error)
+	GetPipelineExecution(ctx context.Context, params *codepipeline.GetPipelineExecutionInput, optFns ...func(*codepipeline.Options)) (*codepipeline.GetPipelineExecutionOutput, error)
+	GetPipelineState(ctx context.Context, params *codepipeline.GetPipelineStateInput, optFns ...func(*codepipeline.Options)) (*codepipeline.GetPipelineStateOutput, error)
+}
+
+// clock is how the poller waits, so tests can use a fake one.
+type clock interface {
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// change is one thing that changed between two polls of an execution.
+type change struct {
+	key    string
+	stage  string
+	action string
+	status string
+}
+
+// event is sent by the poller whenever an execution changes, carrying the
+// new state along with what changed. A poll that fails sends an event with
+// err set, unless it failed the same way last time.
+type event struct {
+	status  types.PipelineExecutionStatus
+	stages  []types.StageState
+	changes []change
+	err     error
+}
+
+// finished reports whether the event is the execution finishing.
+func (ev event) finished() bool {
+	for _, c := range ev.changes {
+		if c.key == "execution" {
+			return finished(ev.status)
+		}
+	}
+	return false
+}
+
+// poller polls an execution, speeding up while it changes and slowing
+// down while it doesn't, and backing off when CodePipeline throttles it.
+type poller struct {
+	api      pipelineAPI
+	pipeline string
+	clock    clock
+	// jitter spreads out the polls of several people watching the same
+	// pipeline.
+	jitter func(d time.Duration) time.Duration
+
+	min        time.Duration
+	max        time.Duration
+	maxBackoff time.Duration
+	interval   time.Duration
+	wake       chan struct{}
+}
+
+func newPoller(api pipelineAPI, pipeline string) *poller {
+	return &poller{
+		api:      api,
+		pipeline: pipeline,
+		clock:    realClock{},
+		jitter: func(d time.Duration) time.Duration {
+			return d + time.Duration(rand.Int63n(int64(d)/5+1)) - d/10
+		},
+		min:        5 * time.Second,
+		max:        30 * time.Second,
+		maxBackoff: 2 * time.Minute,
+		interval:   5 * time.Second,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// poke makes the poller poll again straight away, after something is done
+// to the execution that will change it.
+func (p *poller) poke() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next works out how long to wait before the next poll.
+func (p *poller) next(changed bool, err error) time.Duration {
+	switch {
+	case throttled(err):
+		p.interval *= 2
+		if p.interval > p.maxBackoff {
+			p.interval = p.maxBackoff
+		}
+	case err != nil:
+	case changed:
+		p.interval = p.min
+	default:
+		p.interval += p.interval / 2
+		if p.interval > p.max {
+			p.interval = p.max
+		}
+	}
+	if p.interval < p.min {
+		p.interval = p.min
+	}
+	return p.jitter(p.interval)
+}
+
+// sleep waits for d, a poke or ctx to be done, returning false for the
+// last.
+func (p *poller) sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-p.clock.After(d):
+		return true
+	case <-p.wake:
+		p.interval = p.min
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func throttled(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "ThrottlingException", "Throttling", "TooManyRequestsException", "RequestLimitExceeded":
+		return true
+	}
+	return false
+}
+
+// waitForExecution returns the latest execution once one is in progress,
+// calling waiting once if it has to wait.
+func (p *poller) waitForExecution(ctx context.Context, waiting func()) (types.PipelineExecutionSummary, error) {
+	for {
+		output, err := p.api.ListPipelineExecutions(ctx, &codepipeline.ListPipelineExecutionsInput{
+			PipelineName: aws.String(p.pipeline),
+			MaxResults:   aws.Int32(1),
+		})
+		if err != nil && !throttled(err) {
+			return types.PipelineExecutionSummary{}, err
+		}
+		if err == nil && len(output.PipelineExecutionSummaries) > 0 && output.PipelineExecutionSummaries[0].Status == types.PipelineExecutionStatusInProgress {
+			return output.PipelineExecutionSummaries[0], nil
+		}
+		if waiting != nil {
+			waiting()
+			waiting = nil
+		}
+		if !p.sleep(ctx, p.next(false, err)) {
+			return types.PipelineExecutionSummary{}, ctx.Err()
+		}
+	}
+}
+
+// run polls an execution until ctx is done, sending an event to events
+// each time it changes. The first poll always sends one.
+func (p *poller) run(ctx context.Context, executionID string, events chan<- event) {
+	previous := map[string]string{}
+	lastErr := ""
+
+	for {
+		ev := p.poll(ctx, executionID)
+		send := false
+		if ev.err != nil {
+			send = ev.err.Error() != lastErr
+			lastErr = ev.err.Error()
+		} else {
+			// After a failed poll, send the state even if it's unchanged so
+			// the error can be cleared.
+			send = lastErr != ""
+			lastErr = ""
+			ev.changes = diffStates(previous, executionStates(executionID, ev))
+			send = send || len(ev.changes) > 0
+			for _, c := range ev.changes {
+				previous[c.key] = c.status
+			}
+		}
+
+		if send {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if !p.sleep(ctx, p.next(len(ev.changes) > 0, ev.err)) {
+			return
+		}
+	}
+}
+
+func (p *poller) poll(ctx context.Context, executionID string) event {
+	execution, err := p.api.GetPipelineExecution(ctx, &codepipeline.GetPipelineExecutionInput{
+		PipelineName:        aws.String(p.pipeline),
+		PipelineExecutionId: aws.String(executionID),
+	})
+	if err != nil {
+		return event{err: fmt.Errorf("unable to get execution %s: %w", executionID, err)}
+	}
+	state, err := p.api.GetPipelineState(ctx, &codepipeline.GetPipelineStateInput{
+		Name: aws.String(p.pipeline),
+	})
+	if err != nil {
+		return event{err: fmt.Errorf("unable to get the state of %s: %w", p.pipeline, err)}
+	}
+	return event{status: execution.PipelineExecution.Status, stages: state.StageStates}
+}
+
+// executionStates lists the status of the execution and each of its
+// stages and actions, in pipeline order.
+func executionStates(executionID string, ev event) []change {
+	states := []change{{key: "execution", status: string(ev.status)}}
+	for _, stage := range ev.stages {
+		if stage.LatestExecution == nil || aws.ToString(stage.LatestExecution.PipelineExecutionId) != executionID {
+			continue
+		}
+		name := aws.ToString(stage.StageName)
+		states = append(states, change{key: "stage/" + name, stage: name, status: string(stage.LatestExecution.Status)})
+		for _, action := range stage.ActionStates {
+			if action.LatestExecution == nil {
+				continue
+			}
+			status := string(action.LatestExecution.Status)
+			if action.LatestExecution.Token != nil {
+				status += "/approval"
+			}
+			actionName := aws.ToString(action.ActionName)
+			states = append(states, change{key: "action/" + name + "/" + actionName, stage: name, action: actionName, status: status})
+		}
+	}
+	return states
+}
+
+// diffStates returns the states that differ from previous.
+func diffStates(previous map[string]string, states []change) []change {
+	changes := []change{}
+	for _, s := range states {
+		if old, ok := previous[s.key]; !ok || old != s.status {
+			changes = append(changes, s)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,251 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+	"github.com/aws/smithy-go"
+)
+
+// fakeClock hands each wait to the test, which lets the poller carry on by
+// sending on fire.
+type fakeClock struct {
+	waits chan time.Duration
+	fire  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{waits: make(chan time.Duration), fire: make(chan time.Time)}
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits <- d
+	return c.fire
+}
+
+// step is the result of one poll: the execution's status and the status
+// of each stage, or an error.
+type step struct {
+	status types.PipelineExecutionStatus
+	stages []string
+	err    error
+}
+
+// stubAPI answers each poll with the next step, repeating the last once
+// they run out.
+type stubAPI struct {
+	steps []step
+	polls int
+}
+
+func (s *stubAPI) current() step {
+	if s.polls > len(s.steps) {
+		return s.steps[len(s.steps)-1]
+	}
+	return s.steps[s.polls-1]
+}
+
+func (s *stubAPI) ListPipelineExecutions(ctx context.Context, params *codepipeline.ListPipelineExecutionsInput, optFns ...func(*codepipeline.Options)) (*codepipeline.ListPipelineExecutionsOutput, error) {
+	return nil, errors.New("not used")
+}
+
+func (s *stubAPI) GetPipelineExecution(ctx context.Context, params *codepipeline.GetPipelineExecutionInput, optFns ...func(*codepipeline.Options)) (*codepipeline.GetPipelineExecutionOutput, error) {
+	s.polls++
+	step := s.current()
+	if step.err != nil {
+		return nil, step.err
+	}
+	return &codepipeline.GetPipelineExecutionOutput{
+		PipelineExecution: &types.PipelineExecution{Status: step.status},
+	}, nil
+}
+
+// GetPipelineState returns the stages of the current step, each given as
+// name=status.
+func (s *stubAPI) GetPipelineState(ctx context.Context, params *codepipeline.GetPipelineStateInput, optFns ...func(*codepipeline.Options)) (*codepipeline.GetPipelineStateOutput, error) {
+	output := &codepipeline.GetPipelineStateOutput{}
+	for _, stage := range s.current().stages {
+		parts := strings.SplitN(stage, "=", 2)
+		name, status := parts[0], parts[1]
+		output.StageStates = append(output.StageStates, types.StageState{
+			StageName: aws.String(name),
+			LatestExecution: &types.StageExecution{
+				PipelineExecutionId: aws.String("exec-1"),
+				Status:              types.StageExecutionStatus(status),
+			},
+		})
+	}
+	return output, nil
+}
+
+var throttling = &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+
+// runPoller runs a poller over steps until it has waited n times,
+// returning each wait and the events it sent.
+func runPoller(t *testing.T, steps []step, n int) ([]time.Duration, []event) {
+	t.Helper()
+	clock := newFakeClock()
+	p := newPoller(&stubAPI{steps: steps}, "my-app")
+	p.clock = clock
+	p.jitter = func(d time.Duration) time.Duration { return d }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan event, n+1)
+	done := make(chan struct{})
+	go func() {
+		p.run(ctx, "exec-1", events)
+		close(done)
+	}()
+
+	waits := []time.Duration{}
+	for len(waits) < n {
+		select {
+		case d := <-clock.waits:
+			waits = append(waits, d)
+			if len(waits) < n {
+				clock.fire <- time.Now()
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("poller stopped after %d waits", len(waits))
+		}
+	}
+	cancel()
+	<-done
+	close(events)
+
+	sent := []event{}
+	for ev := range events {
+		sent = append(sent, ev)
+	}
+	return waits, sent
+}
+
+func seconds(s ...float64) []time.Duration {
+	d := []time.Duration{}
+	for _, v := range s {
+		d = append(d, time.Duration(v*float64(time.Second)))
+	}
+	return d
+}
+
+func changeKeys(ev event) []string {
+	keys := []string{}
+	for _, c := range ev.changes {
+		keys = append(keys, c.key+"="+c.status)
+	}
+	return keys
+}
+
+func TestPollerIntervalGrowsToMax(t *testing.T) {
+	steps := []step{{status: "InProgress", stages: []string{"Source=Succeeded", "Build=InProgress"}}}
+	waits, events := runPoller(t, steps, 8)
+
+	want := seconds(5, 7.5, 11.25, 16.875, 25.3125, 30, 30, 30)
+	if !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+	if len(events) != 1 {
+		t.Errorf("sent %d events, want only the first poll", len(events))
+	}
+}
+
+func TestPollerThrottlingBacksOff(t *testing.T) {
+	steps := []step{
+		{status: "InProgress", stages: []string{"Build=InProgress"}},
+		{err: throttling},
+	}
+	waits, events := runPoller(t, steps, 7)
+
+	want := seconds(5, 10, 20, 40, 80, 120, 120)
+	if !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+	if len(events) != 2 {
+		t.Fatalf("sent %d events, want the first poll and one error", len(events))
+	}
+	if !throttled(events[1].err) {
+		t.Errorf("second event has err %v, want the throttling error", events[1].err)
+	}
+}
+
+func TestPollerOtherErrorsKeepInterval(t *testing.T) {
+	steps := []step{
+		{status: "InProgress", stages: []string{"Build=InProgress"}},
+		{status: "InProgress", stages: []string{"Build=InProgress"}},
+		{err: errors.New("connection reset")},
+	}
+	waits, _ := runPoller(t, steps, 4)
+
+	want := seconds(5, 7.5, 7.5, 7.5)
+	if !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+}
+
+func TestPollerResetsAfterChange(t *testing.T) {
+	building := step{status: "InProgress", stages: []string{"Build=InProgress", "Deploy="}}
+	deploying := step{status: "InProgress", stages: []string{"Build=Succeeded", "Deploy=InProgress"}}
+	steps := []step{building, building, building, building, deploying, deploying, deploying}
+	waits, _ := runPoller(t, steps, 7)
+
+	want := seconds(5, 7.5, 11.25, 16.875, 5, 7.5, 11.25)
+	if !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+}
+
+func TestPollerResetsAfterThrottling(t *testing.T) {
+	steps := []step{
+		{status: "InProgress", stages: []string{"Build=InProgress"}},
+		{err: throttling},
+		{err: throttling},
+		{status: "InProgress", stages: []string{"Build=Succeeded"}},
+	}
+	waits, _ := runPoller(t, steps, 5)
+
+	want := seconds(5, 10, 20, 5, 7.5)
+	if !reflect.DeepEqual(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+}
+
+func TestPollerSendsEachChangeOnce(t *testing.T) {
+	building := step{status: "InProgress", stages: []string{"Source=Succeeded", "Build=InProgress"}}
+	built := step{status: "InProgress", stages: []string{"Source=Succeeded", "Build=Succeeded"}}
+	failed := step{status: "Failed", stages: []string{"Source=Succeeded", "Build=Failed"}}
+	steps := []step{building, building, built, built, {err: throttling}, {err: throttling}, built, failed, failed}
+	_, events := runPoller(t, steps, len(steps))
+
+	want := [][]string{
+		{"execution=InProgress", "stage/Source=Succeeded", "stage/Build=InProgress"},
+		{"stage/Build=Succeeded"},
+		// The error is sent once, then the unchanged state to clear it.
+		nil,
+		{},
+		{"execution=Failed", "stage/Build=Failed"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("sent %d events, want %d", len(events), len(want))
+	}
+	for i, ev := range events {
+		if want[i] == nil {
+			if ev.err == nil {
+				t.Errorf("event %d has no error", i)
+			}
+			continue
+		}
+		if got := changeKeys(ev); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("event %d changes = %v, want %v", i, got, want[i])
+		}
+	}
+	if !events[len(events)-1].finished() {
+		t.Error("last event isn't the execution finishing")
+	}
+}
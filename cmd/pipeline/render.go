@@ -0,0 +1,356 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+	"github.com/logrusorgru/aurora"
+	"golang.org/x/term"
+)
+
+// line is a line of the status screen, drawn in a single colour.
+type line struct {
+	text   string
+	colour func(arg interface{}) aurora.Value
+}
+
+// format colours the line, first cutting it to width so it never wraps.
+func (l line) format(width int) string {
+	text := []rune(l.text)
+	if width > 0 && len(text) >= width {
+		text = text[:width-1]
+	}
+	if l.colour == nil {
+		return string(text)
+	}
+	return l.colour(string(text)).String()
+}
+
+// view is everything the status screen shows about an execution.
+type view struct {
+	pipeline    string
+	executionID string
+	status      types.PipelineExecutionStatus
+	stages      []stageView
+	failed      []failedAction
+	err         string
+	message     string
+	prompt      string
+}
+
+type stageView struct {
+	name string
+	// status is empty if the stage hasn't run in this execution.
+	status  types.StageExecutionStatus
+	actions []actionView
+}
+
+type actionView struct {
+	name     string
+	status   types.ActionExecutionStatus
+	approval bool
+}
+
+// buildView describes the execution being monitored.
+func buildView(e *pipelineStatus, status types.PipelineExecutionStatus) view {
+	executionID := aws.ToString(e.latestExecution[0].PipelineExecutionId)
+	v := view{pipeline: e.pipeline, executionID: executionID, status: status}
+
+	for _, stage := range e.pipelineStageStates {
+		s := stageView{name: aws.ToString(stage.StageName)}
+		if stage.LatestExecution == nil || aws.ToString(stage.LatestExecution.PipelineExecutionId) != executionID {
+			v.stages = append(v.stages, s)
+			continue
+		}
+		s.status = stage.LatestExecution.Status
+		for _, action := range stage.ActionStates {
+			a := actionView{name: aws.ToString(action.ActionName)}
+			if action.LatestExecution != nil {
+				a.status = action.LatestExecution.Status
+				a.approval = a.status == types.ActionExecutionStatusInProgress && action.LatestExecution.Token != nil
+			}
+			s.actions = append(s.actions, a)
+		}
+		v.stages = append(v.stages, s)
+	}
+	return v
+}
+
+// lines lays out the view, without the keys hint or prompt.
+func (v view) lines() []line {
+	lines := []line{
+		{"Monitoring Pipeline: " + v.pipeline, aurora.Cyan},
+		{fmt.Sprintf("Execution %s is %s", v.executionID, v.status), executionColour(v.status)},
+		{"", nil},
+	}
+
+	for _, stage := range v.stages {
+		switch stage.status {
+		case "":
+			lines = append(lines, line{fmt.Sprintf("Stage %s not yet ran", stage.name), aurora.BrightYellow})
+			continue
+		case types.StageExecutionStatusSucceeded:
+			lines = append(lines, line{fmt.Sprintf("Stage %s has completed %s", stage.name, stage.status), aurora.BrightGreen})
+		case types.StageExecutionStatusInProgress:
+			lines = append(lines, line{fmt.Sprintf("Stage %s is in progress", stage.name), aurora.BrightYellow})
+		case types.StageExecutionStatusFailed:
+			lines = append(lines, line{fmt.Sprintf("Stage %s has failed", stage.name), aurora.BrightRed})
+		default:
+			lines = append(lines, line{fmt.Sprintf("Stage %s is %s", stage.name, stage.status), aurora.BrightRed})
+		}
+
+		for _, action := range stage.actions {
+			switch {
+			case action.approval:
+				lines = append(lines, line{fmt.Sprintf("    Action %s is waiting for approval", action.name), aurora.BrightMagenta})
+			case action.status == types.ActionExecutionStatusSucceeded:
+				lines = append(lines, line{fmt.Sprintf("    Action %s has completed %s", action.name, action.status), aurora.BrightBlue})
+			case action.status == types.ActionExecutionStatusInProgress:
+				lines = append(lines, line{fmt.Sprintf("    Action %s is in progress", action.name), aurora.BrightMagenta})
+			case action.status == types.ActionExecutionStatusFailed:
+				lines = append(lines, line{fmt.Sprintf("    Action %s has failed", action.name), aurora.BrightRed})
+			case action.status == "":
+				lines = append(lines, line{fmt.Sprintf("    Action %s not yet ran", action.name), aurora.BrightYellow})
+			default:
+				lines = append(lines, line{fmt.Sprintf("    Action %s is %s", action.name, action.status), aurora.BrightYellow})
+			}
+		}
+	}
+
+	if len(v.failed) > 0 {
+		lines = append(lines, line{"", nil})
+		lines = append(lines, failureLines(v.failed)...)
+	}
+	if v.err != "" || v.message != "" {
+		lines = append(lines, line{"", nil})
+	}
+	if v.err != "" {
+		lines = append(lines, line{v.err, aurora.BrightRed})
+	}
+	if v.message != "" {
+		lines = append(lines, line{v.message, aurora.BrightYellow})
+	}
+	return lines
+}
+
+func executionColour(status types.PipelineExecutionStatus) func(arg interface{}) aurora.Value {
+	switch status {
+	case types.PipelineExecutionStatusSucceeded:
+		return aurora.BrightGreen
+	case types.PipelineExecutionStatusInProgress, types.PipelineExecutionStatusStopping:
+		return aurora.BrightYellow
+	default:
+		return aurora.BrightRed
+	}
+}
+
+// renderer draws the status of an execution as it changes.
+type renderer interface {
+	render(v view)
+	// close leaves the terminal as it was found.
+	close()
+}
+
+// newRenderer returns the full screen renderer and a channel of the keys
+// pressed when running in a terminal, or the log renderer and a nil
+// channel when plain output is asked for, stdin or stdout isn't a terminal,
+// or $CI is set.
+func newRenderer(plain bool) (renderer, <-chan rune) {
+	interactive := term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+	if !plain && interactive && os.Getenv("CI") == "" {
+		if r, err := newTUIRenderer(os.Stdin, os.Stdout); err == nil {
+			return r, r.keys
+		}
+	}
+	return &logRenderer{out: os.Stdout, seen: map[string]string{}}, nil
+}
+
+// readKeys sends each key pressed to keys until in is closed or done is,
+// then closes keys.
+func readKeys(in io.Reader, keys chan<- rune, done <-chan struct{}) {
+	defer close(keys)
+	reader := bufio.NewReader(in)
+	for {
+		r, _, err := reader.ReadRune()
+		if err != nil {
+			return
+		}
+		select {
+		case keys <- r:
+		case <-done:
+			return
+		}
+	}
+}
+
+// clip cuts the lines of a view to fit in height, keeping the header and
+// the end, where failures and messages are, in place of the stages in
+// between.
+func clip(lines []line, height int) []line {
+	const header = 3
+	if height <= 0 || len(lines) <= height {
+		return lines
+	}
+	if height < header+2 {
+		return lines[:height]
+	}
+	tail := height - header - 1
+	clipped := append([]line{}, lines[:header]...)
+	clipped = append(clipped, line{fmt.Sprintf("... %d more lines", len(lines)-header-tail), aurora.Faint})
+	return append(clipped, lines[len(lines)-tail:]...)
+}
+
+const keysHint = "a approve  r retry  l logs  q quit"
+
+// tuiRenderer redraws the screen in place, only writing the lines that
+// changed since the last frame.
+type tuiRenderer struct {
+	in       int
+	out      *os.File
+	oldState *term.State
+	width    int
+	previous []string
+
+	// Keys are read from the terminal opened separately from stdin, so
+	// closing it stops the read once monitoring stops, rather than leaving
+	// it to swallow the next key pressed.
+	tty  *os.File
+	keys chan rune
+	done chan struct{}
+}
+
+func newTUIRenderer(in *os.File, out *os.File) (*tuiRenderer, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, err
+	}
+	oldState, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		tty.Close()
+		return nil, err
+	}
+	// Hide the cursor and start from a clear screen.
+	fmt.Fprint(out, "\x1b[?25l\x1b[2J\x1b[H")
+	r := &tuiRenderer{in: int(in.Fd()), out: out, oldState: oldState, tty: tty, keys: make(chan rune), done: make(chan struct{})}
+	go readKeys(tty, r.keys, r.done)
+	return r, nil
+}
+
+func (r *tuiRenderer) render(v view) {
+	width, height, err := term.GetSize(int(r.out.Fd()))
+	if err != nil || width <= 0 {
+		width, height = 80, 0
+	}
+	var b strings.Builder
+	if width != r.width {
+		// Every line needs cutting to the new width, so start again.
+		r.width = width
+		r.previous = nil
+		b.WriteString("\x1b[2J")
+	}
+
+	lines := []string{}
+	// Leave room for the blank line and the keys hint or prompt.
+	for _, l := range clip(v.lines(), height-2) {
+		lines = append(lines, l.format(width))
+	}
+	lines = append(lines, "")
+	if v.prompt != "" {
+		lines = append(lines, line{v.prompt, aurora.Bold}.format(width))
+	} else {
+		lines = append(lines, line{keysHint, aurora.Faint}.format(width))
+	}
+
+	for i, l := range lines {
+		if i < len(r.previous) && r.previous[i] == l {
+			continue
+		}
+		fmt.Fprintf(&b, "\x1b[%d;1H%s\x1b[K", i+1, l)
+	}
+	if len(lines) < len(r.previous) {
+		fmt.Fprintf(&b, "\x1b[%d;1H\x1b[J", len(lines)+1)
+	}
+	r.previous = lines
+	io.WriteString(r.out, b.String())
+}
+
+func (r *tuiRenderer) close() {
+	// Drop the keys hint, leaving the last frame on screen above the
+	// cursor.
+	last := len(r.previous) - 1
+	if last < 0 {
+		last = 0
+	}
+	fmt.Fprintf(r.out, "\x1b[%d;1H\x1b[J\x1b[?25h", last)
+	close(r.done)
+	r.tty.Close()
+	term.Restore(r.in, r.oldState)
+}
+
+// logRenderer prints each change of state once, for CI logs and anywhere
+// else the screen can't be redrawn.
+type logRenderer struct {
+	out  io.Writer
+	seen map[string]string
+}
+
+func (r *logRenderer) render(v view) {
+	r.print("execution", string(v.status), fmt.Sprintf("Pipeline %s execution %s is %s", v.pipeline, v.executionID, v.status))
+	for _, stage := range v.stages {
+		if stage.status == "" {
+			continue
+		}
+		r.print("stage/"+stage.name, string(stage.status), fmt.Sprintf("Stage %s is %s", stage.name, stage.status))
+		for _, action := range stage.actions {
+			if action.status == "" {
+				continue
+			}
+			status := string(action.status)
+			if action.approval {
+				status = "waiting for approval"
+			}
+			r.print("action/"+stage.name+"/"+action.name, status, fmt.Sprintf("Action %s in stage %s is %s", action.name, stage.name, status))
+		}
+	}
+	if len(v.failed) == 0 {
+		// Forget failures once they're retried, so they're printed again if
+		// the retry fails too.
+		for key := range r.seen {
+			if strings.HasPrefix(key, "failed/") {
+				delete(r.seen, key)
+			}
+		}
+	}
+	for _, f := range v.failed {
+		if _, ok := r.seen["failed/"+f.stage+"/"+f.action]; ok {
+			continue
+		}
+		r.seen["failed/"+f.stage+"/"+f.action] = f.code
+		for _, l := range failureLines([]failedAction{f}) {
+			fmt.Fprintln(r.out, l.text)
+		}
+	}
+	if v.err != "" {
+		r.print("err", v.err, v.err)
+	}
+	if v.message != "" {
+		r.print("message", v.message, v.message)
+	}
+}
+
+// print writes text if key's state has changed since it was last printed.
+func (r *logRenderer) print(key string, state string, text string) {
+	if r.seen[key] == state {
+		return
+	}
+	r.seen[key] = state
+	fmt.Fprintf(r.out, "%s %s\n", time.Now().Format("15:04:05"), text)
+}
+
+func (r *logRenderer) close() {}
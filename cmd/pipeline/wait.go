@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var waitPipeline string
+var waitExecutionID string
+var waitTimeout time.Duration
+
+// Exit codes for pipeline wait and pipeline status.
+const (
+	exitSucceeded  = 0
+	exitError      = 1
+	exitFailed     = 2
+	exitStopped    = 3
+	exitSuperseded = 4
+	exitTimeout    = 5
+)
+
+// waitCmd represents the pipeline wait command
+var waitCmd = &cobra.Command{
+	Use:   "wait --pipeline <name>",
+	Short: "Wait for a pipeline execution to finish",
+	Long: `Block until a pipeline execution finishes, for gating CI jobs. Without
+--execution-id the latest execution is waited for. Each stage transition
+is written to stderr and the final status to stdout.
+
+Exit codes:
+  0  Succeeded
+  1  error, such as the pipeline not existing
+  2  Failed
+  3  Stopped or Cancelled
+  4  Superseded
+  5  timed out
+
+  awsclihelper pipeline wait --pipeline my-app --timeout 45m`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(exitError)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+		defer cancel()
+
+		p := newPoller(c.PIPELINE, waitPipeline)
+		executionID := waitExecutionID
+		if executionID == "" {
+			if executionID, err = latestExecutionID(ctx, c, waitPipeline); err != nil {
+				fmt.Fprintln(os.Stderr, aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(exitError)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s Waiting for %s execution %s\n", time.Now().Format("15:04:05"), waitPipeline, executionID)
+
+		status, err := waitForCompletion(ctx, p, executionID)
+		if ctx.Err() == context.DeadlineExceeded {
+			fmt.Fprintf(os.Stderr, "%s Timed out after %s\n", time.Now().Format("15:04:05"), waitTimeout)
+			fmt.Println("Timeout")
+			os.Exit(exitTimeout)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(exitError)
+		}
+		fmt.Println(status)
+		os.Exit(exitCode(status))
+	},
+}
+
+func latestExecutionID(ctx context.Context, c *internal.Client, pipeline string) (string, error) {
+	output, err := c.PIPELINE.ListPipelineExecutions(ctx, &codepipeline.ListPipelineExecutionsInput{
+		PipelineName: aws.String(pipeline),
+		MaxResults:   aws.Int32(1),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to get the executions of %s: %w", pipeline, err)
+	}
+	if len(output.PipelineExecutionSummaries) == 0 {
+		return "", fmt.Errorf("%s has never run", pipeline)
+	}
+	return aws.ToString(output.PipelineExecutionSummaries[0].PipelineExecutionId), nil
+}
+
+// waitForCompletion polls the execution until it finishes or ctx is done,
+// writing each stage transition to stderr. Errors the poller recovers from
+// are reported but don't stop the wait, apart from the execution not
+// existing.
+func waitForCompletion(ctx context.Context, p *poller, executionID string) (types.PipelineExecutionStatus, error) {
+	events := make(chan event)
+	go p.run(ctx, executionID, events)
+
+	for {
+		select {
+		case ev := <-events:
+			if ev.err != nil {
+				var notFound *types.PipelineExecutionNotFoundException
+				var noPipeline *types.PipelineNotFoundException
+				if errors.As(ev.err, &notFound) || errors.As(ev.err, &noPipeline) {
+					return "", ev.err
+				}
+				fmt.Fprintf(os.Stderr, "%s %s\n", time.Now().Format("15:04:05"), ev.err)
+				continue
+			}
+			for _, c := range ev.changes {
+				if c.action == "" && c.stage != "" {
+					fmt.Fprintf(os.Stderr, "%s Stage %s is %s\n", time.Now().Format("15:04:05"), c.stage, c.status)
+				}
+			}
+			if finished(ev.status) {
+				return ev.status, nil
+			}
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// exitCode maps how an execution ended to the exit code documented for
+// pipeline wait. Executions still running, because monitoring stopped
+// early, exit 0.
+func exitCode(status types.PipelineExecutionStatus) int {
+	switch status {
+	case types.PipelineExecutionStatusFailed:
+		return exitFailed
+	case types.PipelineExecutionStatusStopped, types.PipelineExecutionStatusCancelled:
+		return exitStopped
+	case types.PipelineExecutionStatusSuperseded:
+		return exitSuperseded
+	default:
+		return exitSucceeded
+	}
+}
+
+func init() {
+	pipelineCmd.AddCommand(waitCmd)
+
+	waitCmd.Flags().StringVar(&waitPipeline, "pipeline", "", "Pipeline to wait for")
+	waitCmd.Flags().StringVar(&waitExecutionID, "execution-id", "", "Execution to wait for (default the latest)")
+	waitCmd.Flags().DurationVar(&waitTimeout, "timeout", 30*time.Minute, "How long to wait before giving up")
+	waitCmd.MarkFlagRequired("pipeline")
+}
@@ -0,0 +1,272 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+)
+
+// watcher follows an execution until it finishes or the user quits,
+// drawing it with a renderer and acting on the keys pressed.
+type watcher struct {
+	e        *pipelineStatus
+	c        *internal.Client
+	p        *poller
+	r        renderer
+	status   types.PipelineExecutionStatus
+	failed   []failedAction
+	err      string
+	message  string
+	approval *approvalPrompt
+}
+
+// approvalPrompt is an approval being answered in the status screen.
+type approvalPrompt struct {
+	stage   string
+	action  string
+	token   string
+	decided bool
+	approve bool
+	summary []rune
+}
+
+// finished reports whether an execution has stopped for good.
+func finished(status types.PipelineExecutionStatus) bool {
+	switch status {
+	case types.PipelineExecutionStatusSucceeded, types.PipelineExecutionStatusFailed,
+		types.PipelineExecutionStatusStopped, types.PipelineExecutionStatusSuperseded,
+		types.PipelineExecutionStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// run watches the execution, returning its status when it finishes or the
+// user quits. Without keys it returns as soon as the execution finishes,
+// otherwise a failed execution is left on screen to be retried.
+func (w *watcher) run(keys <-chan rune) types.PipelineExecutionStatus {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan event)
+	go w.p.run(ctx, aws.ToString(w.e.latestExecution[0].PipelineExecutionId), events)
+
+	for {
+		select {
+		case ev := <-events:
+			w.apply(ev)
+		case k, ok := <-keys:
+			if !ok {
+				keys = nil
+				continue
+			}
+			if w.key(k) {
+				return w.status
+			}
+		case <-signals:
+			return w.status
+		}
+
+		w.r.render(w.view())
+		if finished(w.status) && (keys == nil || w.status != types.PipelineExecutionStatusFailed) {
+			return w.status
+		}
+	}
+}
+
+func (w *watcher) view() view {
+	v := buildView(w.e, w.status)
+	v.failed = w.failed
+	v.err = w.err
+	v.message = w.message
+	if p := w.approval; p != nil {
+		if !p.decided {
+			v.prompt = fmt.Sprintf("Approve %s in %s? y to approve, n to reject, esc to cancel", p.action, p.stage)
+		} else {
+			v.prompt = fmt.Sprintf("Summary: %s_   enter to send, esc to cancel", string(p.summary))
+		}
+	}
+	return v
+}
+
+// apply updates the watcher with what the poller saw, notifying when the
+// execution finishes.
+func (w *watcher) apply(ev event) {
+	if ev.err != nil {
+		w.err = ev.err.Error()
+		return
+	}
+	w.err = ""
+	w.status = ev.status
+	w.e.pipelineStageStates = ev.stages
+
+	if w.status != types.PipelineExecutionStatusFailed {
+		w.failed = nil
+	} else if w.failed == nil {
+		var err error
+		if w.failed, err = failedActions(w.e, w.c); err != nil {
+			w.message = "Unable to get action execution details: " + err.Error()
+		}
+	}
+
+	if ev.finished() {
+		if errs := notifyCompletion(w.e, w.status); len(errs) > 0 {
+			messages := []string{}
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			w.message = "Unable to send notification: " + strings.Join(messages, ", ")
+		}
+	}
+}
+
+// key acts on a key press, returning true to quit.
+func (w *watcher) key(k rune) bool {
+	if w.approval != nil {
+		w.approvalKey(k)
+		return false
+	}
+
+	switch k {
+	case 'q', 3:
+		return true
+	case 'a':
+		w.startApproval()
+	case 'r':
+		w.retry()
+	case 'l':
+		w.openLogs()
+	}
+	return false
+}
+
+func (w *watcher) startApproval() {
+	executionID := aws.ToString(w.e.latestExecution[0].PipelineExecutionId)
+	for _, stage := range w.e.pipelineStageStates {
+		if stage.LatestExecution == nil || aws.ToString(stage.LatestExecution.PipelineExecutionId) != executionID {
+			continue
+		}
+		for _, action := range stage.ActionStates {
+			if action.LatestExecution != nil && action.LatestExecution.Status == types.ActionExecutionStatusInProgress && action.LatestExecution.Token != nil {
+				w.approval = &approvalPrompt{
+					stage:  aws.ToString(stage.StageName),
+					action: aws.ToString(action.ActionName),
+					token:  aws.ToString(action.LatestExecution.Token),
+				}
+				return
+			}
+		}
+	}
+	w.message = "Nothing is waiting for approval"
+}
+
+// approvalKey answers the approval prompt: y or n, then a summary.
+func (w *watcher) approvalKey(k rune) {
+	p := w.approval
+	switch {
+	case k == 27 || k == 3:
+		w.approval = nil
+		w.message = "Approval cancelled"
+	case !p.decided:
+		if k == 'y' || k == 'n' {
+			p.decided = true
+			p.approve = k == 'y'
+		}
+	case k == '\r' || k == '\n':
+		w.approval = nil
+		if err := putApproval(w.e, w.c, p.stage, p.action, p.token, p.approve, string(p.summary)); err != nil {
+			w.message = "Unable to send approval: " + err.Error()
+			return
+		}
+		if p.approve {
+			w.message = fmt.Sprintf("Approved %s", p.action)
+		} else {
+			w.message = fmt.Sprintf("Rejected %s", p.action)
+		}
+		w.p.poke()
+	case k == 127 || k == 8:
+		if len(p.summary) > 0 {
+			p.summary = p.summary[:len(p.summary)-1]
+		}
+	case unicode.IsPrint(k):
+		p.summary = append(p.summary, k)
+	}
+}
+
+func (w *watcher) retry() {
+	if w.status != types.PipelineExecutionStatusFailed || len(w.failed) == 0 {
+		w.message = "Only failed actions can be retried"
+		return
+	}
+	retried, err := retryFailedStages(w.e, w.c, w.failed)
+	if len(retried) > 0 {
+		// The execution carries on, so watch it as if it never failed.
+		w.failed = nil
+		w.status = types.PipelineExecutionStatusInProgress
+		w.message = "Retrying failed actions in " + strings.Join(retried, ", ")
+		w.p.poke()
+	}
+	if err != nil {
+		w.message = err.Error()
+	}
+}
+
+// openLogs opens the failed action's log or details in a browser, or the
+// details of an action still running.
+func (w *watcher) openLogs() {
+	link := ""
+	for _, f := range w.failed {
+		if link = f.link(); link != "" {
+			break
+		}
+	}
+	if link == "" {
+		for _, stage := range w.e.pipelineStageStates {
+			for _, action := range stage.ActionStates {
+				if link == "" && action.LatestExecution != nil && action.LatestExecution.Status == types.ActionExecutionStatusInProgress {
+					link = aws.ToString(action.LatestExecution.ExternalExecutionUrl)
+				}
+			}
+		}
+	}
+	if link == "" {
+		w.message = "No logs to open"
+		return
+	}
+	if err := openURL(link); err != nil {
+		w.message = fmt.Sprintf("Unable to open %s: %s", link, err)
+		return
+	}
+	w.message = "Opened " + link
+}
+
+// putApproval approves or rejects a manual approval action.
+func putApproval(e *pipelineStatus, c *internal.Client, stageName string, actionName string, token string, approve bool, summary string) error {
+	status := types.ApprovalStatusRejected
+	if approve {
+		status = types.ApprovalStatusApproved
+	}
+	_, err := c.PIPELINE.PutApprovalResult(context.TODO(), &codepipeline.PutApprovalResultInput{
+		PipelineName: aws.String(e.pipeline),
+		StageName:    aws.String(stageName),
+		ActionName:   aws.String(actionName),
+		Token:        aws.String(token),
+		Result: &types.ApprovalResult{
+			Status:  status,
+			Summary: aws.String(summary),
+		},
+	})
+	return err
+}
@@ -26,6 +26,9 @@ var cfgFile string
 var region string
 var profile string
 
+// regionSource records how the effective region was resolved.
+var regionSource string
+
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:   "awsclihelper ",
@@ -50,10 +53,9 @@ func init() {
 	// will be global for your application.
 
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.awsclihelper.yaml)")
-	RootCmd.PersistentFlags().StringP("region", "r", "eu-west-1", "AWS Region")
+	RootCmd.PersistentFlags().StringP("region", "r", "", "AWS Region, a comma separated list of regions, or all (default $AWS_REGION or eu-west-1)")
 	RootCmd.PersistentFlags().StringP("profile", "p", "", "AWS Profile to use ")
 
-	RootCmd.MarkFlagRequired("region")
 	RootCmd.MarkFlagRequired("profile")
 
 	viper.BindPFlag("profile", RootCmd.PersistentFlags().Lookup("profile"))
@@ -83,4 +85,31 @@ func initConfig() {
 
 	viper.AutomaticEnv() // read in environment variables that match
 
+	regionSource = resolveRegion()
+}
+
+// defaultRegion is used when no region is given by flag, environment or
+// config file.
+const defaultRegion = "eu-west-1"
+
+// resolveRegion settles the region to use, reporting whether it came from
+// the flag, the environment, the config file or the default.
+func resolveRegion() string {
+	switch {
+	case RootCmd.PersistentFlags().Changed("region"):
+		return "flag"
+	case os.Getenv("REGION") != "":
+		return "env"
+	case os.Getenv("AWS_REGION") != "":
+		viper.Set("region", os.Getenv("AWS_REGION"))
+		return "env"
+	case os.Getenv("AWS_DEFAULT_REGION") != "":
+		viper.Set("region", os.Getenv("AWS_DEFAULT_REGION"))
+		return "env"
+	case viper.InConfig("region"):
+		return "config"
+	default:
+		viper.Set("region", defaultRegion)
+		return "default"
+	}
 }
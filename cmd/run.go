@@ -0,0 +1,479 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+type runTarget struct {
+	client   *internal.Client
+	id       string
+	name     string
+	platform types.PlatformType
+}
+
+type runResult struct {
+	target   runTarget
+	status   types.CommandInvocationStatus
+	exitCode int32
+	err      error
+}
+
+var runTargets string
+var runMaxConcurrency string
+var runMaxErrors string
+var runTimeout time.Duration
+var runOutputBucket string
+
+// SendCommand accepts at most 50 instance IDs per call.
+const runBatchSize = 50
+
+// GetCommandInvocation returns at most this many characters of each
+// output stream. The rest is only kept if the command writes to S3.
+const runOutputLimit = 24000
+
+// runCmd represents the run command
+var runCmd = &cobra.Command{
+	Use:   "run [--targets spec] -- <command>",
+	Short: "Run a shell command on many instances with SSM Run Command",
+	Long: `Run a shell command on SSM managed instances and stream each
+instance's output, prefixed with its name.
+
+Targets are a comma separated list of instance IDs and tag:Key=Value
+filters, for example --targets tag:Role=web,tag:Env=prod. Without
+--targets the instances are chosen from a list.
+
+Linux instances run the command with AWS-RunShellScript and Windows
+instances with AWS-RunPowerShellScript. The command exits non-zero if it
+failed on any instance, and is cancelled on instances still running it
+when --timeout is reached.
+
+SSM only returns the first 24000 characters of each instance's output.
+Use --output-s3-bucket to keep all of it in S3.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		command := strings.Join(args, " ")
+
+		clients, err := internal.NewClients()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		internal.RegionHeader(clients)
+
+		targets, err := selectRunTargets(clients, runTargets)
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		results := runCommand(targets, command)
+		if !printRunSummary(results) {
+			os.Exit(1)
+		}
+	},
+}
+
+// selectRunTargets resolves the --targets spec in every region, or asks
+// for instances when no spec is given.
+func selectRunTargets(clients []*internal.Client, spec string) ([]runTarget, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	targets := []runTarget{}
+	errs := []error{}
+
+	for _, client := range clients {
+		wg.Add(1)
+		go func(c *internal.Client) {
+			defer wg.Done()
+			found, err := findRunTargets(c, spec)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", c.Region, err))
+			}
+			targets = append(targets, found...)
+		}(client)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		fmt.Println(aurora.BrightRed(err))
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("no managed instances match the targets")
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].name < targets[j].name })
+	if spec != "" {
+		return targets, nil
+	}
+
+	items := []internal.Item{}
+	byID := map[string]runTarget{}
+	for _, t := range targets {
+		label := t.id + " : " + t.name
+		if len(clients) > 1 {
+			label = fmt.Sprintf("[%s] %s", t.client.Region, label)
+		}
+		items = append(items, internal.Item{
+			ID:      t.id,
+			Label:   label,
+			Preview: []string{"Instance  " + t.id, "Name      " + t.name, "Platform  " + string(t.platform)},
+		})
+		byID[t.id] = t
+	}
+	chosen, err := internal.PickMany("Choose instances to run on:", "ec2", items)
+	if err != nil {
+		return nil, err
+	}
+	targets = []runTarget{}
+	for _, item := range chosen {
+		targets = append(targets, byID[item.ID])
+	}
+	return targets, nil
+}
+
+// findRunTargets lists the online managed instances matching spec.
+func findRunTargets(c *internal.Client, spec string) ([]runTarget, error) {
+	filters := []types.InstanceInformationStringFilter{{
+		Key:    aws.String("PingStatus"),
+		Values: []string{string(types.PingStatusOnline)},
+	}}
+	ids := []string{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+		case strings.HasPrefix(part, "tag:"):
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("target %s must be tag:Key=Value", part)
+			}
+			filters = append(filters, types.InstanceInformationStringFilter{Key: aws.String(kv[0]), Values: []string{kv[1]}})
+		default:
+			ids = append(ids, part)
+		}
+	}
+	if len(ids) > 0 {
+		filters = append(filters, types.InstanceInformationStringFilter{Key: aws.String("InstanceIds"), Values: ids})
+	}
+
+	targets := []runTarget{}
+	paginator := ssm.NewDescribeInstanceInformationPaginator(c.SSM, &ssm.DescribeInstanceInformationInput{Filters: filters})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range output.InstanceInformationList {
+			targets = append(targets, runTarget{
+				client:   c,
+				id:       aws.ToString(info.InstanceId),
+				name:     aws.ToString(info.InstanceId),
+				platform: info.PlatformType,
+			})
+		}
+	}
+
+	// Prefer Name tags for output prefixes where the instance has one.
+	for i := 0; i < len(targets); i += runBatchSize {
+		batch := []string{}
+		for _, t := range targets[i:min(i+runBatchSize, len(targets))] {
+			if strings.HasPrefix(t.id, "i-") {
+				batch = append(batch, t.id)
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		output, err := c.EC2.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{InstanceIds: batch})
+		if err != nil {
+			continue
+		}
+		names := map[string]string{}
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				for _, tag := range instance.Tags {
+					if aws.ToString(tag.Key) == "Name" {
+						names[aws.ToString(instance.InstanceId)] = aws.ToString(tag.Value)
+					}
+				}
+			}
+		}
+		for j := range targets {
+			if name, ok := names[targets[j].id]; ok {
+				targets[j].name = name
+			}
+		}
+	}
+
+	return targets, nil
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// runCommand sends the command to every target, grouped by region and
+// platform, and follows each invocation until it finishes.
+func runCommand(targets []runTarget, command string) []runResult {
+	type group struct {
+		client   *internal.Client
+		document string
+		targets  []runTarget
+	}
+	groups := map[string]*group{}
+	order := []string{}
+	for _, t := range targets {
+		document := "AWS-RunShellScript"
+		if t.platform == types.PlatformTypeWindows {
+			document = "AWS-RunPowerShellScript"
+		}
+		key := t.client.Region + "/" + document
+		if groups[key] == nil {
+			groups[key] = &group{client: t.client, document: document}
+			order = append(order, key)
+		}
+		groups[key].targets = append(groups[key].targets, t)
+	}
+
+	ctx := context.Background()
+	if runTimeout > 0 {
+		var cancel context.CancelFunc
+		// Allow the instances time to report a timeout before giving up.
+		ctx, cancel = context.WithTimeout(ctx, runTimeout+time.Minute)
+		defer cancel()
+	}
+
+	var printMu sync.Mutex
+	var wg sync.WaitGroup
+	results := make([]runResult, 0, len(targets))
+	var resultsMu sync.Mutex
+	record := func(r runResult) {
+		resultsMu.Lock()
+		results = append(results, r)
+		resultsMu.Unlock()
+	}
+
+	for _, key := range order {
+		g := groups[key]
+		for i := 0; i < len(g.targets); i += runBatchSize {
+			batch := g.targets[i:min(i+runBatchSize, len(g.targets))]
+			commandID, err := sendCommand(ctx, g.client, g.document, batch, command)
+			if err != nil {
+				for _, t := range batch {
+					record(runResult{target: t, err: err})
+				}
+				continue
+			}
+
+			for _, t := range batch {
+				wg.Add(1)
+				go func(t runTarget) {
+					defer wg.Done()
+					record(followInvocation(ctx, t, commandID, &printMu))
+				}(t)
+			}
+		}
+	}
+	wg.Wait()
+
+	return results
+}
+
+func sendCommand(ctx context.Context, c *internal.Client, document string, targets []runTarget, command string) (string, error) {
+	ids := []string{}
+	for _, t := range targets {
+		ids = append(ids, t.id)
+	}
+
+	input := &ssm.SendCommandInput{
+		DocumentName:   aws.String(document),
+		InstanceIds:    ids,
+		Parameters:     map[string][]string{"commands": {command}},
+		MaxConcurrency: aws.String(runMaxConcurrency),
+		MaxErrors:      aws.String(runMaxErrors),
+		Comment:        aws.String("awsclihelper run"),
+	}
+	if runOutputBucket != "" {
+		input.OutputS3BucketName = aws.String(runOutputBucket)
+		input.OutputS3KeyPrefix = aws.String("awsclihelper-run")
+	}
+	if runTimeout > 0 {
+		input.Parameters["executionTimeout"] = []string{fmt.Sprint(int(runTimeout.Seconds()))}
+	}
+
+	output, err := c.SSM.SendCommand(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.Command.CommandId), nil
+}
+
+// followInvocation polls one instance's invocation, printing any new output
+// as it appears, until it reaches a final state. If ctx is done first the
+// command is cancelled on the instance.
+func followInvocation(ctx context.Context, t runTarget, commandID string, printMu *sync.Mutex) runResult {
+	printed := map[string]int{}
+	interval := time.Second
+
+	for {
+		select {
+		case <-ctx.Done():
+			return cancelInvocation(t, commandID, ctx.Err())
+		case <-time.After(interval):
+		}
+		if interval < 5*time.Second {
+			interval *= 2
+		}
+
+		output, err := t.client.SSM.GetCommandInvocation(ctx, &ssm.GetCommandInvocationInput{
+			CommandId:  aws.String(commandID),
+			InstanceId: aws.String(t.id),
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return cancelInvocation(t, commandID, ctx.Err())
+			}
+			// The invocation takes a moment to appear after SendCommand.
+			var notFound *types.InvocationDoesNotExist
+			if errors.As(err, &notFound) {
+				continue
+			}
+			return runResult{target: t, exitCode: -1, err: err}
+		}
+
+		done := false
+		switch output.Status {
+		case types.CommandInvocationStatusSuccess,
+			types.CommandInvocationStatusFailed,
+			types.CommandInvocationStatusCancelled,
+			types.CommandInvocationStatusTimedOut:
+			done = true
+		}
+
+		printMu.Lock()
+		printNew(t, "stdout", aws.ToString(output.StandardOutputContent), printed, done)
+		printNew(t, "stderr", aws.ToString(output.StandardErrorContent), printed, done)
+		if done {
+			printTruncated(t, "stdout", aws.ToString(output.StandardOutputContent), aws.ToString(output.StandardOutputUrl))
+			printTruncated(t, "stderr", aws.ToString(output.StandardErrorContent), aws.ToString(output.StandardErrorUrl))
+		}
+		printMu.Unlock()
+
+		if done {
+			return runResult{target: t, status: output.Status, exitCode: output.ResponseCode}
+		}
+	}
+}
+
+// cancelInvocation stops the command on an instance once runCommand has
+// given up waiting for it, so it isn't left running unwatched.
+func cancelInvocation(t runTarget, commandID string, reason error) runResult {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := t.client.SSM.CancelCommand(ctx, &ssm.CancelCommandInput{
+		CommandId:   aws.String(commandID),
+		InstanceIds: []string{t.id},
+	})
+	if err != nil {
+		reason = fmt.Errorf("%w, and cancelling the command failed: %s", reason, err)
+	}
+	return runResult{target: t, status: types.CommandInvocationStatusTimedOut, exitCode: -1, err: reason}
+}
+
+// printNew prints the complete lines of an output stream not yet shown,
+// each prefixed with the instance name. A partly written last line is held
+// back until it's finished, or until the invocation is done.
+func printNew(t runTarget, stream string, content string, printed map[string]int, done bool) {
+	fresh := content[min(printed[stream], len(content)):]
+	if !done {
+		end := strings.LastIndex(fresh, "\n")
+		if end == -1 {
+			return
+		}
+		fresh = fresh[:end+1]
+	}
+	if fresh == "" {
+		return
+	}
+	printed[stream] += len(fresh)
+
+	prefix := aurora.BrightCyan(fmt.Sprintf("[%s]", t.name))
+	for _, line := range strings.Split(strings.TrimSuffix(fresh, "\n"), "\n") {
+		if stream == "stderr" {
+			fmt.Fprintln(os.Stderr, prefix, aurora.BrightRed(line))
+		} else {
+			fmt.Println(prefix, line)
+		}
+	}
+}
+
+// printTruncated says where to find the rest of an output stream SSM cut
+// short.
+func printTruncated(t runTarget, stream string, content string, url string) {
+	if len(content) < runOutputLimit {
+		return
+	}
+	message := fmt.Sprintf("%s was cut off at %d characters, use --output-s3-bucket to keep all of it", stream, runOutputLimit)
+	if url != "" {
+		message = fmt.Sprintf("%s was cut off at %d characters, all of it is in %s", stream, runOutputLimit, url)
+	}
+	fmt.Fprintln(os.Stderr, aurora.BrightCyan(fmt.Sprintf("[%s]", t.name)), aurora.BrightYellow(message))
+}
+
+// printRunSummary reports each instance's result, returning false if any
+// of them failed.
+func printRunSummary(results []runResult) bool {
+	sort.Slice(results, func(i, j int) bool { return results[i].target.name < results[j].target.name })
+
+	fmt.Println()
+	fmt.Println(aurora.Bold("Summary"))
+	succeeded := 0
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			fmt.Printf("  %-30s %-12s %s\n", r.target.name, aurora.BrightRed("Error"), r.err)
+		case r.status == types.CommandInvocationStatusSuccess:
+			succeeded++
+			fmt.Printf("  %-30s %-12s exit %d\n", r.target.name, aurora.BrightGreen(r.status), r.exitCode)
+		default:
+			fmt.Printf("  %-30s %-12s exit %d\n", r.target.name, aurora.BrightRed(r.status), r.exitCode)
+		}
+	}
+
+	failed := len(results) - succeeded
+	if failed > 0 {
+		fmt.Println(aurora.Bold(aurora.BrightRed(fmt.Sprintf("%d succeeded, %d failed", succeeded, failed))))
+		return false
+	}
+	fmt.Println(aurora.Bold(aurora.BrightGreen(fmt.Sprintf("%d succeeded", succeeded))))
+	return true
+}
+
+func init() {
+	RootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().StringVarP(&runTargets, "targets", "t", "", "Instance IDs and tag:Key=Value filters, comma separated")
+	runCmd.Flags().StringVar(&runMaxConcurrency, "max-concurrency", "50", "Maximum instances to run on at once, as a number or percentage")
+	runCmd.Flags().StringVar(&runMaxErrors, "max-errors", "0", "Errors allowed before the command is stopped on remaining instances, as a number or percentage")
+	runCmd.Flags().DurationVar(&runTimeout, "timeout", time.Hour, "Maximum time the command may run on each instance")
+	runCmd.Flags().StringVar(&runOutputBucket, "output-s3-bucket", "", "S3 bucket to write each instance's full output to")
+}
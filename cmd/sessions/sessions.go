@@ -0,0 +1,116 @@
+package sessions
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jjkirkpatrick/awsclihelper/cmd"
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+var listLimit int
+var replaySpeed float64
+var replayMaxIdle time.Duration
+
+// sessionsCmd represents the sessions command
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List and replay past connect sessions",
+	Long: `Every connect ec2, connect ecs and connect ssh-proxy session is logged
+with the caller ARN, target, session document, start and end time and
+exit status. Sessions run with --record, or with "record: true" in the
+config file, also keep an asciinema cast of their output that can be
+replayed here or with asciinema itself.
+
+Recording reads the session output through a pipe rather than the
+terminal, so full screen programs on the instance may not match the size
+of the local terminal.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var listCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List past sessions, most recent first",
+	Run: func(cmd *cobra.Command, args []string) {
+		records, err := internal.SessionRecords()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		if len(records) == 0 {
+			fmt.Println(aurora.BrightYellow("No sessions recorded"))
+			return
+		}
+
+		shown := 0
+		for i := len(records) - 1; i >= 0 && (listLimit <= 0 || shown < listLimit); i-- {
+			r := records[i]
+			shown++
+
+			status := aurora.BrightGreen(fmt.Sprintf("exit %d", r.ExitCode))
+			if r.ExitCode != 0 {
+				status = aurora.BrightRed(fmt.Sprintf("exit %d", r.ExitCode))
+			}
+			cast := ""
+			if r.Cast != "" {
+				cast = "recorded"
+			}
+			fmt.Printf("%-23s %s %-9s %-22s %-28s %-7s %s %s\n",
+				aurora.BrightCyan(r.ID),
+				r.Start.Local().Format("2006-01-02 15:04"),
+				r.End.Sub(r.Start).Round(time.Second),
+				r.Target,
+				r.Document,
+				status,
+				r.Caller,
+				aurora.Faint(cast),
+			)
+		}
+	},
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <id>",
+	Short: "Replay a recorded session",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		records, err := internal.SessionRecords()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+
+		for _, r := range records {
+			if r.ID != args[0] {
+				continue
+			}
+			if r.Cast == "" {
+				fmt.Println(aurora.Bold(aurora.BrightRed("Session " + r.ID + " was not recorded")))
+				os.Exit(1)
+			}
+			if err := internal.Replay(r.Cast, os.Stdout, replaySpeed, replayMaxIdle); err != nil {
+				fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+				os.Exit(1)
+			}
+			return
+		}
+
+		fmt.Println(aurora.Bold(aurora.BrightRed("No session " + args[0])))
+		os.Exit(1)
+	},
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(sessionsCmd)
+	sessionsCmd.AddCommand(listCmd)
+	sessionsCmd.AddCommand(replayCmd)
+
+	listCmd.Flags().IntVarP(&listLimit, "limit", "n", 20, "Number of sessions to show, 0 for all")
+	replayCmd.Flags().Float64Var(&replaySpeed, "speed", 1, "Playback speed multiplier")
+	replayCmd.Flags().DurationVar(&replayMaxIdle, "max-idle", 2*time.Second, "Longest pause between output, 0 for none")
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jjkirkpatrick/awsclihelper/internal"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+type identity struct {
+	Account          string     `json:"account"`
+	Alias            string     `json:"alias,omitempty"`
+	Arn              string     `json:"arn"`
+	UserID           string     `json:"userId"`
+	Role             string     `json:"role,omitempty"`
+	SessionName      string     `json:"sessionName,omitempty"`
+	Profile          string     `json:"profile,omitempty"`
+	CredentialSource string     `json:"credentialSource"`
+	Expires          *time.Time `json:"expires,omitempty"`
+	Region           string     `json:"region"`
+	RegionSource     string     `json:"regionSource"`
+}
+
+var whoamiOutput string
+var whoamiCheck int
+
+// whoamiCmd represents the whoami command
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the identity and credentials in use",
+	Long: `Show the account, ARN, assumed role and session name of the current
+credentials, where they were loaded from and when they expire, along
+with the effective region and how it was resolved.
+
+Use --check N in scripts to exit non-zero when the credentials expire
+within N minutes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := internal.NewClient()
+		if err != nil {
+			fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+			os.Exit(1)
+		}
+		whoami(c)
+	},
+}
+
+func whoami(c *internal.Client) {
+	creds, err := c.Credentials(context.TODO())
+	if err != nil {
+		fmt.Println(aurora.Bold(aurora.BrightRed(err)))
+		os.Exit(1)
+	}
+
+	id := identity{
+		Account:          *c.Identity.Account,
+		Arn:              *c.Identity.Arn,
+		UserID:           *c.Identity.UserId,
+		Profile:          c.Profile,
+		CredentialSource: internal.CredentialSource(creds),
+		Region:           c.Region,
+		RegionSource:     regionSource,
+	}
+	id.Role, id.SessionName = internal.AssumedRole(id.Arn)
+	if creds.CanExpire {
+		expires := creds.Expires
+		id.Expires = &expires
+	}
+	// Listing the alias needs iam:ListAccountAliases, which many roles lack.
+	if alias, err := c.AccountAlias(context.TODO()); err == nil {
+		id.Alias = alias
+	}
+
+	if whoamiOutput == "json" {
+		out, _ := json.MarshalIndent(id, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		printIdentity(id)
+	}
+
+	if whoamiCheck > 0 && id.Expires != nil && time.Until(*id.Expires) < time.Duration(whoamiCheck)*time.Minute {
+		if whoamiOutput != "json" {
+			fmt.Println(aurora.Bold(aurora.BrightRed(fmt.Sprintf("Credentials expire within %d minutes", whoamiCheck))))
+		}
+		os.Exit(2)
+	}
+}
+
+func printIdentity(id identity) {
+	field := func(name string, value string) {
+		if value != "" {
+			fmt.Printf("%-18s %s\n", aurora.BrightGreen(name), aurora.BrightCyan(value))
+		}
+	}
+
+	field("Account", id.Account)
+	field("Alias", id.Alias)
+	field("ARN", id.Arn)
+	field("Role", id.Role)
+	field("Session", id.SessionName)
+	field("Profile", id.Profile)
+	field("Credentials", id.CredentialSource)
+	if id.Expires != nil {
+		field("Expires", fmt.Sprintf("%s (in %s)", id.Expires.Local().Format(time.RFC1123), time.Until(*id.Expires).Round(time.Minute)))
+	} else {
+		field("Expires", "never")
+	}
+	field("Region", fmt.Sprintf("%s (%s)", id.Region, id.RegionSource))
+}
+
+func init() {
+	RootCmd.AddCommand(whoamiCmd)
+
+	whoamiCmd.Flags().StringVarP(&whoamiOutput, "output", "o", "text", "Output format: text or json")
+	whoamiCmd.Flags().IntVar(&whoamiCheck, "check", 0, "Exit non-zero if credentials expire within this many minutes")
+}
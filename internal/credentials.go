@@ -0,0 +1,289 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/logrusorgru/aurora"
+	"golang.org/x/term"
+)
+
+// mfaProvider retrieves credentials for profiles with an mfa_serial. The
+// resulting session is cached on disk so that later commands run before
+// expiry don't prompt for a new token code.
+type mfaProvider struct {
+	profile string
+	region  string
+	shared  config.SharedConfig
+}
+
+type cachedCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time
+}
+
+const credentialCacheSource = "MFACredentialCache"
+
+func newMFAProvider(profile string, region string, shared config.SharedConfig) aws.CredentialsProvider {
+	return aws.NewCredentialsCache(&mfaProvider{
+		profile: profile,
+		region:  region,
+		shared:  shared,
+	})
+}
+
+func (p *mfaProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	if creds, err := readCachedCredentials(p.profile); err == nil {
+		return creds, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, aurora.BrightYellow("Ignoring credential cache: "+err.Error()))
+	}
+
+	code, err := promptMFACode(p.shared.MFASerial)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	base, err := p.baseConfig(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	client := sts.NewFromConfig(base)
+
+	var creds cachedCredentials
+	if p.shared.RoleARN != "" {
+		input := &sts.AssumeRoleInput{
+			RoleArn:         aws.String(p.shared.RoleARN),
+			RoleSessionName: aws.String(p.roleSessionName()),
+			SerialNumber:    aws.String(p.shared.MFASerial),
+			TokenCode:       aws.String(code),
+		}
+		if p.shared.ExternalID != "" {
+			input.ExternalId = aws.String(p.shared.ExternalID)
+		}
+		if p.shared.RoleDurationSeconds != nil {
+			input.DurationSeconds = aws.Int32(int32(p.shared.RoleDurationSeconds.Seconds()))
+		}
+		output, err := client.AssumeRole(ctx, input)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		creds = cachedCredentials{
+			AccessKeyID:     *output.Credentials.AccessKeyId,
+			SecretAccessKey: *output.Credentials.SecretAccessKey,
+			SessionToken:    *output.Credentials.SessionToken,
+			Expires:         *output.Credentials.Expiration,
+		}
+	} else {
+		output, err := client.GetSessionToken(ctx, &sts.GetSessionTokenInput{
+			SerialNumber: aws.String(p.shared.MFASerial),
+			TokenCode:    aws.String(code),
+		})
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		creds = cachedCredentials{
+			AccessKeyID:     *output.Credentials.AccessKeyId,
+			SecretAccessKey: *output.Credentials.SecretAccessKey,
+			SessionToken:    *output.Credentials.SessionToken,
+			Expires:         *output.Credentials.Expiration,
+		}
+	}
+
+	if err := writeCachedCredentials(p.profile, creds); err != nil {
+		fmt.Fprintln(os.Stderr, aurora.BrightYellow("Unable to cache credentials: "+err.Error()))
+	}
+
+	return creds.toAWS(), nil
+}
+
+// baseConfig loads the credentials the MFA call is made with. Role
+// profiles authenticate with their source profile or credential source,
+// while plain MFA profiles exchange their own long-term keys for a session
+// token.
+func (p *mfaProvider) baseConfig(ctx context.Context) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(p.region)}
+	switch {
+	case p.shared.RoleARN != "" && p.shared.SourceProfileName != "":
+		opts = append(opts, config.WithSharedConfigProfile(p.shared.SourceProfileName))
+	case p.shared.RoleARN != "" && p.shared.CredentialSource != "":
+		provider, err := credentialSourceProvider(p.shared.CredentialSource)
+		if err != nil {
+			return aws.Config{}, fmt.Errorf("profile %s: %w", p.profile, err)
+		}
+		opts = append(opts, config.WithCredentialsProvider(provider))
+	default:
+		opts = append(opts, config.WithSharedConfigProfile(p.profile))
+	}
+	return config.LoadDefaultConfig(ctx, opts...)
+}
+
+// credentialSourceProvider returns the provider for a profile's
+// credential_source, as the SDK would resolve it for a role profile.
+func credentialSourceProvider(source string) (aws.CredentialsProvider, error) {
+	switch source {
+	case "Environment":
+		key, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if key == "" || secret == "" {
+			return nil, errors.New("credential_source is Environment but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY aren't set")
+		}
+		return credentials.NewStaticCredentialsProvider(key, secret, os.Getenv("AWS_SESSION_TOKEN")), nil
+	case "Ec2InstanceMetadata":
+		return aws.NewCredentialsCache(ec2rolecreds.New()), nil
+	case "EcsContainer":
+		path := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+		if path == "" {
+			return nil, errors.New("credential_source is EcsContainer but AWS_CONTAINER_CREDENTIALS_RELATIVE_URI isn't set")
+		}
+		return aws.NewCredentialsCache(endpointcreds.New("http://169.254.170.2"+path, func(o *endpointcreds.Options) {
+			o.AuthorizationToken = os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+		})), nil
+	default:
+		return nil, fmt.Errorf("unknown credential_source %s, use Environment, Ec2InstanceMetadata or EcsContainer", source)
+	}
+}
+
+func (p *mfaProvider) roleSessionName() string {
+	if p.shared.RoleSessionName != "" {
+		return p.shared.RoleSessionName
+	}
+	return fmt.Sprintf("awsclihelper-%d", time.Now().Unix())
+}
+
+func (c cachedCredentials) toAWS() aws.Credentials {
+	return aws.Credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		Source:          credentialCacheSource,
+		CanExpire:       true,
+		Expires:         c.Expires,
+	}
+}
+
+// promptMFACode asks for a token code on stderr, so that stdout stays
+// clean for commands such as ssh-proxy whose output is a data stream. When
+// stdin is such a stream too the code is read from the terminal instead.
+func promptMFACode(serial string) (string, error) {
+	in := os.Stdin
+	if !term.IsTerminal(int(in.Fd())) {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return "", fmt.Errorf("an MFA code for %s is needed but there is no terminal to ask for it: %w", serial, err)
+		}
+		defer tty.Close()
+		in = tty
+	}
+
+	code := ""
+	prompt := &survey.Password{
+		Message: fmt.Sprintf("MFA code for %s:", serial),
+	}
+	validCode := regexp.MustCompile(`^\d{6}$`)
+	err := survey.AskOne(prompt, &code, survey.WithStdio(in, os.Stderr, os.Stderr), survey.WithValidator(func(ans interface{}) error {
+		if s, ok := ans.(string); !ok || !validCode.MatchString(s) {
+			return errors.New("MFA code must be 6 digits")
+		}
+		return nil
+	}))
+	return code, err
+}
+
+// credentialCacheDir returns the directory holding the session cache,
+// creating it with owner-only permissions if needed. The cache is
+// protected by those permissions alone, as ~/.aws/credentials is.
+func credentialCacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, "awsclihelper", "credentials")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err := checkPrivate(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// checkPrivate refuses files and directories that are readable by anyone
+// other than the owner.
+func checkPrivate(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s has permissions %s, expected owner-only access", path, info.Mode().Perm())
+	}
+	return nil
+}
+
+func readCachedCredentials(profile string) (aws.Credentials, error) {
+	dir, err := credentialCacheDir()
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	path := filepath.Join(dir, profile+".json")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	if err := checkPrivate(path); err != nil {
+		return aws.Credentials{}, err
+	}
+
+	var creds cachedCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return aws.Credentials{}, fmt.Errorf("%s is corrupt: %w", path, err)
+	}
+	// Treat sessions about to expire as missing so a command doesn't fail
+	// part way through.
+	if time.Now().Add(time.Minute).After(creds.Expires) {
+		os.Remove(path)
+		return aws.Credentials{}, os.ErrNotExist
+	}
+	return creds.toAWS(), nil
+}
+
+func writeCachedCredentials(profile string, creds cachedCredentials) error {
+	dir, err := credentialCacheDir()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, profile+".json")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
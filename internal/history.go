@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Target is a connect destination remembered in the history or as a
+// bookmark.
+type Target struct {
+	// Kind is "ec2" or "ecs".
+	Kind  string `json:"kind"`
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	// Tags identify an EC2 target again after the instance is replaced.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Cluster and Group identify an ECS target again after the task is
+	// replaced, Group being the task group such as service:web.
+	Cluster string    `json:"cluster,omitempty"`
+	Group   string    `json:"group,omitempty"`
+	Profile string    `json:"profile,omitempty"`
+	Region  string    `json:"region"`
+	Time    time.Time `json:"time"`
+}
+
+type history struct {
+	Targets []Target `json:"targets"`
+}
+
+const (
+	historyFile   = "history.json"
+	bookmarksFile = "bookmarks.json"
+	maxHistory    = 50
+)
+
+// ErrNoHistory is returned by LastTarget before anything has been connected to.
+var ErrNoHistory = errors.New("no previous connections")
+
+// RecordTarget adds a target to the front of the connection history.
+func RecordTarget(t Target) error {
+	h := history{}
+	if err := readState(historyFile, &h); err != nil {
+		return err
+	}
+	t.Time = time.Now()
+	h.Targets = append([]Target{t}, h.Targets...)
+	if len(h.Targets) > maxHistory {
+		h.Targets = h.Targets[:maxHistory]
+	}
+	return writeState(historyFile, h)
+}
+
+// LastTarget returns the most recently connected target.
+func LastTarget() (Target, error) {
+	h := history{}
+	if err := readState(historyFile, &h); err != nil {
+		return Target{}, err
+	}
+	if len(h.Targets) == 0 {
+		return Target{}, ErrNoHistory
+	}
+	return h.Targets[0], nil
+}
+
+// Bookmarks returns the saved bookmarks sorted by name.
+func Bookmarks() ([]string, map[string]Target, error) {
+	bookmarks := map[string]Target{}
+	if err := readState(bookmarksFile, &bookmarks); err != nil {
+		return nil, nil, err
+	}
+	names := []string{}
+	for name := range bookmarks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, bookmarks, nil
+}
+
+// Bookmark looks up a single bookmark by name.
+func Bookmark(name string) (Target, error) {
+	_, bookmarks, err := Bookmarks()
+	if err != nil {
+		return Target{}, err
+	}
+	t, ok := bookmarks[name]
+	if !ok {
+		return Target{}, fmt.Errorf("no bookmark named %s", name)
+	}
+	return t, nil
+}
+
+// SaveBookmark stores a target under name, replacing any existing bookmark.
+func SaveBookmark(name string, t Target) error {
+	_, bookmarks, err := Bookmarks()
+	if err != nil {
+		return err
+	}
+	t.Time = time.Now()
+	bookmarks[name] = t
+	return writeState(bookmarksFile, bookmarks)
+}
+
+// RemoveBookmark deletes the named bookmark.
+func RemoveBookmark(name string) error {
+	_, bookmarks, err := Bookmarks()
+	if err != nil {
+		return err
+	}
+	if _, ok := bookmarks[name]; !ok {
+		return fmt.Errorf("no bookmark named %s", name)
+	}
+	delete(bookmarks, name)
+	return writeState(bookmarksFile, bookmarks)
+}
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// AccountAlias returns the account alias, or an empty string if none is set.
+func (c *Client) AccountAlias(ctx context.Context) (string, error) {
+	output, err := c.IAM.ListAccountAliases(ctx, &iam.ListAccountAliasesInput{})
+	if err != nil {
+		return "", err
+	}
+	if len(output.AccountAliases) == 0 {
+		return "", nil
+	}
+	return output.AccountAliases[0], nil
+}
+
+// SimulatePrincipalPolicy evaluates whether the IAM user or role principal
+// may perform each action on any resource, returning the decision for
+// each: allowed, explicitDeny or implicitDeny.
+func (c *Client) SimulatePrincipalPolicy(ctx context.Context, principal string, actions []string) (map[string]string, error) {
+	decisions := map[string]string{}
+	paginator := iam.NewSimulatePrincipalPolicyPaginator(c.IAM, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principal),
+		ActionNames:     actions,
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range output.EvaluationResults {
+			decisions[aws.ToString(result.EvalActionName)] = string(result.EvalDecision)
+		}
+	}
+	return decisions, nil
+}
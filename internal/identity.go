@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Credentials returns the credentials the client is signing requests with.
+func (c *Client) Credentials(ctx context.Context) (aws.Credentials, error) {
+	return c.config.Credentials.Retrieve(ctx)
+}
+
+// CredentialSource maps the SDK provider name to where the credentials
+// were found.
+func CredentialSource(creds aws.Credentials) string {
+	switch {
+	case creds.Source == "EnvConfigCredentials":
+		return "env"
+	case strings.HasPrefix(creds.Source, "SharedConfigCredentials"):
+		return "profile"
+	case creds.Source == "AssumeRoleProvider":
+		return "profile (assume role)"
+	case creds.Source == credentialCacheSource:
+		return "profile (mfa session)"
+	case creds.Source == "SSOProvider":
+		return "SSO"
+	case creds.Source == "EC2RoleProvider":
+		return "IMDS"
+	case creds.Source == "CredentialsEndpointProvider":
+		return "container"
+	case creds.Source == "WebIdentityCredentials":
+		return "web identity"
+	case creds.Source == "ProcessProvider":
+		return "credential process"
+	default:
+		return creds.Source
+	}
+}
+
+// AssumedRole splits an sts assumed-role ARN into the role and session
+// name. Both are empty for IAM users and root.
+func AssumedRole(arn string) (string, string) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || !strings.HasPrefix(parts[5], "assumed-role/") {
+		return "", ""
+	}
+	resource := strings.SplitN(strings.TrimPrefix(parts[5], "assumed-role/"), "/", 2)
+	if len(resource) != 2 {
+		return resource[0], ""
+	}
+	return resource[0], resource[1]
+}
@@ -1,143 +1,244 @@
-package internal
-
-import (
-	"context"
-	"errors"
-	"fmt"
-	"os"
-	"os/exec"
-	"os/signal"
-	"regexp"
-	"syscall"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ecs"
-	"github.com/aws/aws-sdk-go-v2/service/route53"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
-	"github.com/logrusorgru/aurora"
-	"github.com/spf13/viper"
-)
-
-type Client struct {
-	config   *aws.Config
-	Profile  string
-	Region   string
-	EC2      *ec2.Client
-	ECS      *ecs.Client
-	SSM      *ssm.Client
-	STS      *sts.Client
-	PIPELINE *codepipeline.Client
-	R53      *route53.Client
-}
-
-func NewClient() (*Client, error) {
-	config := newConfig()
-	Profile, _ := getProfile()
-	client := &Client{
-		config:   config,
-		Region:   viper.GetString("region"),
-		Profile:  Profile,
-		EC2:      ec2.NewFromConfig(*config),
-		ECS:      ecs.NewFromConfig(*config),
-		SSM:      ssm.NewFromConfig(*config),
-		STS:      sts.NewFromConfig(*config),
-		PIPELINE: codepipeline.NewFromConfig(*config),
-		R53:      route53.NewFromConfig(*config),
-	}
-	return client, nil
-}
-
-func newConfig() *aws.Config {
-	if !validateRegion(viper.GetString("region")) {
-		fmt.Println("Invalid region")
-		os.Exit(0)
-	}
-
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(viper.GetString("region")),
-	)
-
-	profile, err := getProfile()
-	if err == nil {
-		config.WithSharedConfigProfile(profile)
-	}
-
-	if !testCredentials(&cfg) {
-		fmt.Println(aurora.BrightRed("Credentials are Invalid, please check your credentials use --profile to specify profile"))
-		os.Exit(0)
-	}
-
-	return &cfg
-}
-
-func testCredentials(cfg *aws.Config) bool {
-	client := sts.NewFromConfig(*cfg)
-	_, err := client.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
-	if err != nil {
-		return false
-	}
-	return true
-}
-
-func getProfile() (string, error) {
-	profile := viper.GetString("profile")
-	if profile == "" {
-		//read env var for AWS_DEFAULT_PROFILE
-		profile = os.Getenv("AWS_DEFAULT_PROFILE")
-		viper.Set("Profile", profile)
-	}
-
-	if profile != "" {
-		return profile, nil
-	} else {
-		return "", errors.New("No profile found")
-	}
-
-}
-
-func validateRegion(region string) bool {
-	reg, _ := regexp.Compile("^(us|eu|ap|sa|ca)\\-\\w+\\-\\d+$")
-	regChina, _ := regexp.Compile("^cn\\-\\w+\\-\\d+$")
-	regUsGov, _ := regexp.Compile("^us\\-gov\\-\\w+\\-\\d+$")
-
-	return reg.MatchString(region) || regChina.MatchString(region) || regUsGov.MatchString(region)
-}
-
-func (c *Client) CmdHeader() {
-
-	if c.Profile != "" {
-		fmt.Println(aurora.Bold(aurora.BrightGreen("Running with Profile ")), aurora.BrightCyan(viper.GetString("profile")), aurora.BrightGreen("and Region "), aurora.BrightCyan(viper.GetString("region")))
-	} else {
-		fmt.Println(aurora.Bold(aurora.BrightGreen("Running with")), aurora.BrightCyan("Default Credentials"), aurora.BrightGreen("and Region "), aurora.BrightCyan(viper.GetString("region")))
-	}
-
-}
-
-func RunCommand(process string, args ...string) error {
-	cmd := exec.Command(process, args...)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	cmd.Stdin = os.Stdin
-
-	// Capture any SIGINTs and discard them
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, os.Interrupt, syscall.SIGINT)
-	go func() {
-		for {
-			select {
-			case <-sigs:
-			}
-		}
-	}()
-	defer close(sigs)
-
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-
-	return nil
-}
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/viper"
+)
+
+type Client struct {
+	config   *aws.Config
+	Profile  string
+	Region   string
+	EC2      *ec2.Client
+	ECS      *ecs.Client
+	SSM      *ssm.Client
+	STS      *sts.Client
+	PIPELINE *codepipeline.Client
+	R53      *route53.Client
+	IAM      *iam.Client
+	Identity *sts.GetCallerIdentityOutput
+}
+
+func NewClient() (*Client, error) {
+	regions := Regions()
+	if len(regions) != 1 {
+		fmt.Fprintln(os.Stderr, aurora.BrightRed("This command only supports a single region"))
+		os.Exit(1)
+	}
+	profile, _ := getProfile()
+	return newClient(profile, regions[0])
+}
+
+// NewClientFor returns a client for a profile and region other than those
+// given with --profile and --region, for commands working across two
+// accounts or regions. An empty profile or region uses the one given.
+func NewClientFor(profile string, region string) (*Client, error) {
+	if profile == "" {
+		profile, _ = getProfile()
+	}
+	if region == "" {
+		regions := Regions()
+		if len(regions) != 1 {
+			return nil, errors.New("this command only supports a single region")
+		}
+		region = regions[0]
+	}
+	return newClient(profile, region)
+}
+
+func newClient(profile string, region string) (*Client, error) {
+	config, identity, err := newConfig(profile, region)
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{
+		config:   config,
+		Identity: identity,
+		Region:   region,
+		Profile:  profile,
+		EC2:      ec2.NewFromConfig(*config),
+		ECS:      ecs.NewFromConfig(*config),
+		SSM:      ssm.NewFromConfig(*config),
+		STS:      sts.NewFromConfig(*config),
+		PIPELINE: codepipeline.NewFromConfig(*config),
+		R53:      route53.NewFromConfig(*config),
+		IAM:      iam.NewFromConfig(*config),
+	}
+	client.refreshRegions()
+	return client, nil
+}
+
+func newConfig(profile string, region string) (*aws.Config, *sts.GetCallerIdentityOutput, error) {
+	if !validateRegion(region) {
+		return nil, nil, fmt.Errorf("invalid region %s", region)
+	}
+
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(region),
+	}
+
+	if profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(profile))
+
+		shared, err := config.LoadSharedConfigProfile(context.TODO(), profile)
+		if err == nil && shared.MFASerial != "" {
+			opts = append(opts, config.WithCredentialsProvider(newMFAProvider(profile, region, shared)))
+		}
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// As only the shape of the region has been checked, this is also where
+	// a region that doesn't exist is caught.
+	identity, err := testCredentials(&cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to authenticate in %s, please check the region and your credentials or use --profile to specify a profile: %w", region, err)
+	}
+
+	return &cfg, identity, nil
+}
+
+func testCredentials(cfg *aws.Config) (*sts.GetCallerIdentityOutput, error) {
+	client := sts.NewFromConfig(*cfg)
+	return client.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+}
+
+func getProfile() (string, error) {
+	profile := viper.GetString("profile")
+	if profile == "" {
+		//read env var for AWS_DEFAULT_PROFILE
+		profile = os.Getenv("AWS_DEFAULT_PROFILE")
+		viper.Set("Profile", profile)
+	}
+
+	if profile != "" {
+		return profile, nil
+	} else {
+		return "", errors.New("No profile found")
+	}
+
+}
+
+func (c *Client) CmdHeader() {
+
+	if c.Profile != "" {
+		fmt.Println(aurora.Bold(aurora.BrightGreen("Running with Profile ")), aurora.BrightCyan(viper.GetString("profile")), aurora.BrightGreen("and Region "), aurora.BrightCyan(c.Region))
+	} else {
+		fmt.Println(aurora.Bold(aurora.BrightGreen("Running with")), aurora.BrightCyan("Default Credentials"), aurora.BrightGreen("and Region "), aurora.BrightCyan(c.Region))
+	}
+
+}
+
+func RunCommand(process string, args ...string) error {
+	return runCommand(os.Stdout, nil, process, args...)
+}
+
+// RunCommandEnv runs a command like RunCommand with env as its environment.
+func RunCommandEnv(env []string, process string, args ...string) error {
+	return runCommand(os.Stdout, env, process, args...)
+}
+
+func runCommand(stdout io.Writer, env []string, process string, args ...string) error {
+	cmd := exec.Command(process, args...)
+	cmd.Env = env
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = stdout
+	cmd.Stdin = os.Stdin
+
+	// Capture any SIGINTs and discard them
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGINT)
+	go func() {
+		for range sigs {
+		}
+	}()
+	defer close(sigs)
+	defer signal.Stop(sigs)
+
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CLIArgs returns the region and profile arguments for running the aws CLI
+// against the same account as the client. The profile is left out when
+// CLIEnv passes the client's credentials on instead.
+func (c *Client) CLIArgs() []string {
+	args := []string{"--region=" + c.Region}
+	if c.Profile != "" && c.CLIEnv() == nil {
+		args = append(args, "--profile="+c.Profile)
+	}
+	return args
+}
+
+// Flags returns the --region and --profile flags that select the same
+// account and region in another run of this tool.
+func (c *Client) Flags() []string {
+	args := []string{"--region=" + c.Region}
+	if c.Profile != "" {
+		args = append(args, "--profile="+c.Profile)
+	}
+	return args
+}
+
+// CLIEnv returns the environment for aws CLI child processes. MFA session
+// credentials are only known to this tool, so the CLI would prompt for a
+// code again, or fall back to the long-term keys, if given the profile;
+// they're passed as environment variables instead. For any other
+// credentials it returns nil, so the child inherits this environment.
+func (c *Client) CLIEnv() []string {
+	creds, err := c.Credentials(context.TODO())
+	if err != nil || creds.Source != credentialCacheSource {
+		return nil
+	}
+
+	env := []string{}
+	for _, kv := range os.Environ() {
+		switch strings.SplitN(kv, "=", 2)[0] {
+		case "AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN":
+			continue
+		}
+		env = append(env, kv)
+	}
+	return append(env,
+		"AWS_ACCESS_KEY_ID="+creds.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY="+creds.SecretAccessKey,
+		"AWS_SESSION_TOKEN="+creds.SessionToken,
+	)
+}
+
+// ShortArn returns the resource ID or name at the end of an ARN, such as
+// the task ID of an ECS task ARN.
+func ShortArn(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// ShellQuote quotes s for a POSIX shell, for commands run on instances and
+// containers.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
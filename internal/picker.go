@@ -0,0 +1,469 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/logrusorgru/aurora"
+	"golang.org/x/term"
+)
+
+// Item is a single entry offered by a Picker.
+type Item struct {
+	// ID is the value the caller acts on, and the key used to remember
+	// recent and favourite items.
+	ID    string
+	Label string
+	// Fields holds extra text matched by the filter but not shown in the
+	// list, such as tags or ARNs.
+	Fields []string
+	// Preview is shown in the preview pane while the item is highlighted.
+	Preview []string
+	// Client is the client the item was listed with, set by Labelled.
+	Client *Client
+}
+
+// ErrCancelled is returned when the picker is dismissed without a choice.
+var ErrCancelled = errors.New("selection cancelled")
+
+// Picker is an interactive fuzzy finder. In and Out default to the process
+// terminal but can be any reader and writer, so a session can be driven by
+// a scripted sequence of keystrokes and its frames inspected.
+type Picker struct {
+	Message string
+	Items   []Item
+	Multi   bool
+	// History names the set of recent and favourite items pinned to the
+	// top of the list. Leave empty to disable.
+	History string
+	In      io.Reader
+	Out     io.Writer
+	// Width and Height size the picker when Out isn't a terminal.
+	Width  int
+	Height int
+}
+
+type pickerHistory struct {
+	Recent     []string `json:"recent"`
+	Favourites []string `json:"favourites"`
+}
+
+const maxRecent = 10
+
+type pickerMatch struct {
+	index int
+	score int
+	pin   int
+}
+
+type pickerState struct {
+	query    []rune
+	cursor   int
+	offset   int
+	matches  []pickerMatch
+	selected map[int]bool
+	history  *pickerHistory
+}
+
+type key int
+
+const (
+	keyRune key = iota
+	keyUp
+	keyDown
+	keyEnter
+	keyTab
+	keyBackspace
+	keyFavourite
+	keyCancel
+	keyIgnore
+)
+
+// Pick asks the user to choose one item.
+func Pick(message string, history string, items []Item) (Item, error) {
+	p := &Picker{Message: message, History: history, Items: items}
+	chosen, err := p.Run()
+	if err != nil {
+		return Item{}, err
+	}
+	return chosen[0], nil
+}
+
+// PickMany asks the user to choose one or more items, marking each with tab.
+func PickMany(message string, history string, items []Item) ([]Item, error) {
+	p := &Picker{Message: message, History: history, Items: items, Multi: true}
+	return p.Run()
+}
+
+// Run shows the picker and returns the chosen items.
+func (p *Picker) Run() ([]Item, error) {
+	if len(p.Items) == 0 {
+		return nil, errors.New("nothing to choose from")
+	}
+
+	in, out := p.In, p.Out
+	if in == nil {
+		in = os.Stdin
+	}
+	if out == nil {
+		out = os.Stdout
+	}
+
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		old, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			return nil, err
+		}
+		defer term.Restore(int(f.Fd()), old)
+	}
+
+	width, height := p.Width, p.Height
+	if f, ok := out.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		width, height, _ = term.GetSize(int(f.Fd()))
+	}
+	if width <= 0 {
+		width = 80
+	}
+	if height <= 0 {
+		height = 24
+	}
+
+	// Draw on the alternate screen so the shell scrollback is left intact,
+	// and always put the cursor back however the picker exits.
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	s := &pickerState{selected: map[int]bool{}, history: p.loadHistory()}
+	s.matches = p.filter(s)
+	reader := bufio.NewReader(in)
+
+	for {
+		p.render(out, s, width, height)
+
+		k, r, err := readKey(reader)
+		if err != nil {
+			return nil, ErrCancelled
+		}
+
+		switch k {
+		case keyRune:
+			s.query = append(s.query, r)
+			s.matches = p.filter(s)
+			s.cursor, s.offset = 0, 0
+		case keyBackspace:
+			if len(s.query) > 0 {
+				s.query = s.query[:len(s.query)-1]
+				s.matches = p.filter(s)
+				s.cursor, s.offset = 0, 0
+			}
+		case keyUp:
+			if s.cursor > 0 {
+				s.cursor--
+			}
+		case keyDown:
+			if s.cursor < len(s.matches)-1 {
+				s.cursor++
+			}
+		case keyTab:
+			if p.Multi && len(s.matches) > 0 {
+				i := s.matches[s.cursor].index
+				s.selected[i] = !s.selected[i]
+				if s.cursor < len(s.matches)-1 {
+					s.cursor++
+				}
+			}
+		case keyFavourite:
+			if p.History != "" && len(s.matches) > 0 {
+				s.history.toggleFavourite(p.Items[s.matches[s.cursor].index].ID)
+				p.saveHistory(s.history)
+				s.matches = p.filter(s)
+			}
+		case keyEnter:
+			chosen := []Item{}
+			for i, item := range p.Items {
+				if s.selected[i] {
+					chosen = append(chosen, item)
+				}
+			}
+			if len(chosen) == 0 && len(s.matches) > 0 {
+				chosen = append(chosen, p.Items[s.matches[s.cursor].index])
+			}
+			if len(chosen) == 0 {
+				continue
+			}
+			if p.History != "" {
+				for _, item := range chosen {
+					s.history.addRecent(item.ID)
+				}
+				p.saveHistory(s.history)
+			}
+			return chosen, nil
+		case keyCancel:
+			return nil, ErrCancelled
+		}
+	}
+}
+
+func readKey(r *bufio.Reader) (key, rune, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return keyIgnore, 0, err
+	}
+
+	switch c {
+	case '\r', '\n':
+		return keyEnter, 0, nil
+	case '\t':
+		return keyTab, 0, nil
+	case 127, 8:
+		return keyBackspace, 0, nil
+	case 3, 4:
+		return keyCancel, 0, nil
+	case 6:
+		return keyFavourite, 0, nil
+	case 16:
+		return keyUp, 0, nil
+	case 14:
+		return keyDown, 0, nil
+	case 27:
+		// A lone escape cancels; anything buffered behind it is an escape
+		// sequence for a cursor key.
+		if r.Buffered() == 0 {
+			return keyCancel, 0, nil
+		}
+		next, _, _ := r.ReadRune()
+		if next != '[' && next != 'O' {
+			return keyIgnore, 0, nil
+		}
+		code, _, _ := r.ReadRune()
+		switch code {
+		case 'A':
+			return keyUp, 0, nil
+		case 'B':
+			return keyDown, 0, nil
+		}
+		return keyIgnore, 0, nil
+	}
+
+	if unicode.IsPrint(c) {
+		return keyRune, c, nil
+	}
+	return keyIgnore, 0, nil
+}
+
+// filter scores every item against the query. An empty query keeps the
+// original order with favourites and then recent items pinned to the top.
+func (p *Picker) filter(s *pickerState) []pickerMatch {
+	terms := strings.Fields(strings.ToLower(string(s.query)))
+	matches := []pickerMatch{}
+
+	for i, item := range p.Items {
+		score, ok := matchItem(terms, item)
+		if !ok {
+			continue
+		}
+		matches = append(matches, pickerMatch{index: i, score: score, pin: s.history.pin(item.ID)})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].pin > matches[j].pin
+	})
+	return matches
+}
+
+// matchItem requires every term to fuzzily match at least one of the
+// item's label or fields, and sums the best score for each term.
+func matchItem(terms []string, item Item) (int, bool) {
+	total := 0
+	for _, t := range terms {
+		best, found := 0, false
+		for _, field := range append([]string{item.Label}, item.Fields...) {
+			if score, ok := fuzzyScore(t, strings.ToLower(field)); ok && (!found || score > best) {
+				best, found = score, true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+// fuzzyScore matches pattern as a subsequence of text, favouring runs of
+// consecutive characters and matches at the start of words.
+func fuzzyScore(pattern string, text string) (int, bool) {
+	p := []rune(pattern)
+	if len(p) == 0 {
+		return 0, true
+	}
+
+	score, pi, prev := 0, 0, -2
+	t := []rune(text)
+	for ti, c := range t {
+		if pi == len(p) {
+			break
+		}
+		if c != p[pi] {
+			continue
+		}
+		score++
+		if ti == prev+1 {
+			score += 5
+		}
+		if ti == 0 || strings.ContainsRune(" -_/:.[", t[ti-1]) {
+			score += 8
+		}
+		prev = ti
+		pi++
+	}
+	return score, pi == len(p)
+}
+
+func (p *Picker) render(out io.Writer, s *pickerState, width int, height int) {
+	lines := []string{
+		aurora.Sprintf("%s %s", aurora.BrightGreen("?"), aurora.Bold(p.Message)),
+		aurora.Sprintf("%s %s", aurora.BrightCyan(">"), string(s.query)),
+	}
+
+	// Split what's left between the list and the preview pane, leaving room
+	// for the separator and help lines.
+	listRows := (height - 4) / 2
+	if listRows < 3 {
+		listRows = 3
+	}
+	previewRows := height - len(lines) - listRows - 2
+
+	if s.cursor < s.offset {
+		s.offset = s.cursor
+	} else if s.cursor >= s.offset+listRows {
+		s.offset = s.cursor - listRows + 1
+	}
+
+	for row := 0; row < listRows; row++ {
+		i := s.offset + row
+		if i >= len(s.matches) {
+			lines = append(lines, "")
+			continue
+		}
+		m := s.matches[i]
+		item := p.Items[m.index]
+
+		prefix := "  "
+		if p.Multi {
+			prefix = "[ ] "
+			if s.selected[m.index] {
+				prefix = "[x] "
+			}
+		}
+		if s.history.isFavourite(item.ID) {
+			prefix += "* "
+		}
+		label := truncate(prefix+item.Label, width-2)
+		if i == s.cursor {
+			lines = append(lines, aurora.Sprintf("%s %s", aurora.BrightCyan(">"), aurora.Bold(aurora.BrightCyan(label))))
+		} else {
+			lines = append(lines, "  "+label)
+		}
+	}
+
+	lines = append(lines, aurora.Sprintf(aurora.Faint("%s %d/%d"), strings.Repeat("─", 3), len(s.matches), len(p.Items)))
+	if len(s.matches) > 0 {
+		preview := p.Items[s.matches[s.cursor].index].Preview
+		for i := 0; i < previewRows && i < len(preview); i++ {
+			lines = append(lines, truncate(preview[i], width))
+		}
+	}
+
+	help := "↑/↓ move  enter select  esc cancel"
+	if p.Multi {
+		help = "↑/↓ move  tab mark  enter select  esc cancel"
+	}
+	if p.History != "" {
+		help += "  ctrl-f favourite"
+	}
+
+	fmt.Fprint(out, "\x1b[H\x1b[2J")
+	for _, line := range lines {
+		fmt.Fprint(out, line, "\x1b[K\r\n")
+	}
+	fmt.Fprintf(out, "\x1b[%d;1H%s", height, aurora.Faint(truncate(help, width)))
+}
+
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if width > 0 && len(r) > width {
+		return string(r[:width-1]) + "…"
+	}
+	return s
+}
+
+func (p *Picker) loadHistory() *pickerHistory {
+	h := &pickerHistory{}
+	if p.History == "" {
+		return h
+	}
+	all := map[string]*pickerHistory{}
+	if err := readState("picker.json", &all); err == nil && all[p.History] != nil {
+		h = all[p.History]
+	}
+	return h
+}
+
+func (p *Picker) saveHistory(h *pickerHistory) {
+	all := map[string]*pickerHistory{}
+	readState("picker.json", &all)
+	all[p.History] = h
+	writeState("picker.json", all)
+}
+
+func (h *pickerHistory) addRecent(id string) {
+	recent := []string{id}
+	for _, r := range h.Recent {
+		if r != id && len(recent) < maxRecent {
+			recent = append(recent, r)
+		}
+	}
+	h.Recent = recent
+}
+
+func (h *pickerHistory) isFavourite(id string) bool {
+	for _, f := range h.Favourites {
+		if f == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *pickerHistory) toggleFavourite(id string) {
+	for i, f := range h.Favourites {
+		if f == id {
+			h.Favourites = append(h.Favourites[:i], h.Favourites[i+1:]...)
+			return
+		}
+	}
+	h.Favourites = append(h.Favourites, id)
+}
+
+// pin ranks favourites above recent items, and more recent above older.
+func (h *pickerHistory) pin(id string) int {
+	if h.isFavourite(id) {
+		return maxRecent + 1
+	}
+	for i, r := range h.Recent {
+		if r == id {
+			return maxRecent - i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+var pickerItems = []Item{
+	{ID: "i-1", Label: "web-server", Fields: []string{"Env=prod"}},
+	{ID: "i-2", Label: "worker", Fields: []string{"Env=dev"}},
+	{ID: "i-3", Label: "bastion", Fields: []string{"Env=prod"}},
+}
+
+// runPicker drives a picker with a scripted sequence of keystrokes.
+func runPicker(t *testing.T, p *Picker, keys string) ([]Item, error) {
+	t.Helper()
+	p.Items = pickerItems
+	p.In = strings.NewReader(keys)
+	p.Out = ioutil.Discard
+	p.Width, p.Height = 80, 24
+	return p.Run()
+}
+
+func ids(items []Item) string {
+	s := []string{}
+	for _, item := range items {
+		s = append(s, item.ID)
+	}
+	return strings.Join(s, ",")
+}
+
+func TestPickerEnterReturnsHighlighted(t *testing.T) {
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"\r", "i-1"},
+		{"\x1b[B\r", "i-2"},
+		{"\x1b[B\x1b[B\x1b[A\r", "i-2"},
+		{"\x0e\x0e\r", "i-3"},
+	}
+	for _, tt := range tests {
+		chosen, err := runPicker(t, &Picker{}, tt.keys)
+		if err != nil {
+			t.Fatalf("keys %q: %v", tt.keys, err)
+		}
+		if got := ids(chosen); got != tt.want {
+			t.Errorf("keys %q chose %s, want %s", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestPickerFuzzyFilter(t *testing.T) {
+	tests := []struct {
+		keys string
+		want string
+	}{
+		// A subsequence of the label.
+		{"bstn\r", "i-3"},
+		// Terms may match fields, and every term must match.
+		{"prod web\r", "i-1"},
+		{"prod bas\r", "i-3"},
+		// Word starts score above matches inside words.
+		{"w\r", "i-1"},
+		{"wo\r", "i-2"},
+		// Backspace widens the filter again.
+		{"bast\x7f\x7f\x7f\x7fwork\r", "i-2"},
+	}
+	for _, tt := range tests {
+		chosen, err := runPicker(t, &Picker{}, tt.keys)
+		if err != nil {
+			t.Fatalf("keys %q: %v", tt.keys, err)
+		}
+		if got := ids(chosen); got != tt.want {
+			t.Errorf("keys %q chose %s, want %s", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestPickerNoMatchIgnoresEnter(t *testing.T) {
+	_, err := runPicker(t, &Picker{}, "zzz\r")
+	if !errors.Is(err, ErrCancelled) {
+		t.Errorf("got %v, want ErrCancelled once input runs out", err)
+	}
+}
+
+func TestPickerMultiSelect(t *testing.T) {
+	// Tab marks the highlighted item and moves down, so this marks i-1,
+	// skips i-2 and marks i-3.
+	chosen, err := runPicker(t, &Picker{Multi: true}, "\t\x1b[B\t\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(chosen); got != "i-1,i-3" {
+		t.Errorf("chose %s, want i-1,i-3", got)
+	}
+
+	// Tabbing twice on the same item unmarks it.
+	chosen, err = runPicker(t, &Picker{Multi: true}, "\t\x1b[A\t\t\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(chosen); got != "i-2" {
+		t.Errorf("chose %s, want i-2", got)
+	}
+
+	// Tab does nothing when only one item may be chosen.
+	chosen, err = runPicker(t, &Picker{}, "\t\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(chosen); got != "i-1" {
+		t.Errorf("chose %s, want i-1", got)
+	}
+}
+
+func TestPickerFavouritesArePinned(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	// Favourite bastion then cancel, which still saves the favourite.
+	if _, err := runPicker(t, &Picker{History: "test"}, "\x1b[B\x1b[B\x06\x1b"); !errors.Is(err, ErrCancelled) {
+		t.Fatalf("got %v, want ErrCancelled", err)
+	}
+	chosen, err := runPicker(t, &Picker{History: "test"}, "\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(chosen); got != "i-3" {
+		t.Errorf("chose %s, want the favourite i-3 pinned to the top", got)
+	}
+
+	// Choosing worker makes it recent, below the favourite.
+	if _, err := runPicker(t, &Picker{History: "test"}, "work\r"); err != nil {
+		t.Fatal(err)
+	}
+	chosen, err = runPicker(t, &Picker{History: "test"}, "\x1b[B\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(chosen); got != "i-2" {
+		t.Errorf("chose %s, want the recent i-2 second", got)
+	}
+
+	// A second ctrl-f unfavourites, leaving worker as the only pinned item.
+	if _, err := runPicker(t, &Picker{History: "test"}, "\x06\x1b"); !errors.Is(err, ErrCancelled) {
+		t.Fatalf("got %v, want ErrCancelled", err)
+	}
+	chosen, err = runPicker(t, &Picker{History: "test"}, "\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(chosen); got != "i-2" {
+		t.Errorf("chose %s, want i-2 once i-3 is no longer a favourite", got)
+	}
+
+	// Histories are kept apart by name.
+	chosen, err = runPicker(t, &Picker{History: "other"}, "\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(chosen); got != "i-1" {
+		t.Errorf("chose %s, want i-1 with no history", got)
+	}
+}
+
+func TestPickerCancel(t *testing.T) {
+	for _, keys := range []string{"\x1b", "web\x1b", "\x03", ""} {
+		if _, err := runPicker(t, &Picker{}, keys); !errors.Is(err, ErrCancelled) {
+			t.Errorf("keys %q: got %v, want ErrCancelled", keys, err)
+		}
+	}
+}
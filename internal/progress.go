@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Progress draws a single line progress bar for a transfer of known size.
+type Progress struct {
+	Label string
+	Total int64
+	Out   io.Writer
+
+	done  int64
+	drawn time.Time
+}
+
+const progressWidth = 30
+
+// Add records n more bytes transferred, redrawing at most every 100ms.
+func (p *Progress) Add(n int64) {
+	p.done += n
+	if time.Since(p.drawn) > 100*time.Millisecond || p.done >= p.Total {
+		p.draw()
+	}
+}
+
+// Write lets a Progress sit behind an io.TeeReader or io.MultiWriter.
+func (p *Progress) Write(b []byte) (int, error) {
+	p.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// Finish draws the final state and ends the line.
+func (p *Progress) Finish() {
+	p.draw()
+	fmt.Fprintln(p.Out)
+}
+
+func (p *Progress) draw() {
+	p.drawn = time.Now()
+	ratio := 1.0
+	if p.Total > 0 {
+		ratio = float64(p.done) / float64(p.Total)
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * progressWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+	fmt.Fprintf(p.Out, "\r%s [%s] %3.0f%% %s/%s", p.Label, bar, ratio*100, formatBytes(p.done), formatBytes(p.Total))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,314 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// SessionRecord is the audit entry written for every interactive session.
+type SessionRecord struct {
+	ID       string    `json:"id"`
+	Caller   string    `json:"caller"`
+	Profile  string    `json:"profile,omitempty"`
+	Region   string    `json:"region"`
+	Target   string    `json:"target"`
+	Document string    `json:"document"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	ExitCode int       `json:"exitCode"`
+	Error    string    `json:"error,omitempty"`
+	// Cast is the path of the asciinema recording, if the session was
+	// recorded.
+	Cast string `json:"cast,omitempty"`
+}
+
+const auditFile = "audit.jsonl"
+
+// Recorder writes terminal output as an asciinema v2 cast file.
+type Recorder struct {
+	mu      sync.Mutex
+	w       *bufio.Writer
+	f       *os.File
+	start   time.Time
+	partial []byte
+}
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// NewRecorder creates a cast file at path and writes its header.
+func NewRecorder(path string, title string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := 80, 24
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			width, height = w, h
+		}
+	}
+
+	r := &Recorder{w: bufio.NewWriter(f), f: f, start: time.Now()}
+	header, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	})
+	r.w.Write(header)
+	r.w.WriteString("\n")
+	return r, nil
+}
+
+// Write records p as an output event. Multi-byte characters split across
+// writes are held back until complete, as cast events must be valid UTF-8.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.partial, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.partial = append([]byte(nil), data[cut:]...)
+	if cut == 0 {
+		return len(p), nil
+	}
+
+	event, _ := json.Marshal([]interface{}{time.Since(r.start).Seconds(), "o", string(data[:cut])})
+	if _, err := r.w.Write(append(event, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close flushes and closes the cast file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+func sessionsDir() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "sessions")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// RunSession runs an interactive session command like RunCommand, and
+// writes an audit entry describing it. When recording is enabled with
+// --record or "record: true" in the config file, and record is set, the
+// session output is also saved as a cast file.
+func (c *Client) RunSession(target string, document string, record bool, process string, args ...string) error {
+	rec := SessionRecord{
+		ID:       sessionID(time.Now()),
+		Profile:  c.Profile,
+		Region:   c.Region,
+		Target:   target,
+		Document: document,
+		Start:    time.Now(),
+	}
+	if c.Identity != nil {
+		rec.Caller = *c.Identity.Arn
+	}
+
+	var stdout io.Writer = os.Stdout
+	var recorder *Recorder
+	if record && viper.GetBool("record") {
+		dir, err := sessionsDir()
+		if err == nil {
+			rec.Cast = filepath.Join(dir, rec.ID+".cast")
+			recorder, err = NewRecorder(rec.Cast, target)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.BrightYellow("Unable to record session: "+err.Error()))
+			rec.Cast = ""
+		} else {
+			stdout = io.MultiWriter(os.Stdout, recorder)
+		}
+	}
+
+	err := runCommand(stdout, c.CLIEnv(), process, args...)
+	rec.End = time.Now()
+	if recorder != nil {
+		recorder.Close()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		rec.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		rec.ExitCode = -1
+		rec.Error = err.Error()
+	}
+
+	if auditErr := appendAudit(rec); auditErr != nil {
+		fmt.Fprintln(os.Stderr, aurora.BrightYellow("Unable to write session audit log: "+auditErr.Error()))
+	}
+	return err
+}
+
+// AuditSession writes an audit entry for a session that ran outside
+// RunSession, such as a non-interactive ecs exec.
+func (c *Client) AuditSession(target string, document string, start time.Time, exitCode int, sessionErr error) {
+	rec := SessionRecord{
+		ID:       sessionID(start),
+		Profile:  c.Profile,
+		Region:   c.Region,
+		Target:   target,
+		Document: document,
+		Start:    start,
+		End:      time.Now(),
+		ExitCode: exitCode,
+	}
+	if c.Identity != nil {
+		rec.Caller = *c.Identity.Arn
+	}
+	if sessionErr != nil {
+		rec.Error = sessionErr.Error()
+	}
+	if err := appendAudit(rec); err != nil {
+		fmt.Fprintln(os.Stderr, aurora.BrightYellow("Unable to write session audit log: "+err.Error()))
+	}
+}
+
+// sessionID names a session by when it started, with a random suffix so
+// that sessions started in the same second, such as an ecs exec across
+// several tasks, don't share an ID or cast file.
+func sessionID(start time.Time) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return start.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+func appendAudit(rec SessionRecord) error {
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, auditFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// SessionRecords returns the audit log, oldest first.
+func SessionRecords() ([]SessionRecord, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, auditFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []SessionRecord{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rec := SessionRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// Replay plays a cast file back to out in real time, scaled by speed, with
+// pauses capped at maxIdle.
+func Replay(path string, out io.Writer, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		speed = 1
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	if !scanner.Scan() {
+		return fmt.Errorf("%s is empty", path)
+	}
+	header := castHeader{}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != 2 {
+		return fmt.Errorf("%s is not an asciinema v2 recording", path)
+	}
+
+	last := 0.0
+	for scanner.Scan() {
+		var event []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) != 3 {
+			continue
+		}
+		at, _ := event[0].(float64)
+		kind, _ := event[1].(string)
+		data, _ := event[2].(string)
+		if kind != "o" {
+			continue
+		}
+
+		wait := time.Duration((at - last) / speed * float64(time.Second))
+		if maxIdle > 0 && wait > maxIdle {
+			wait = maxIdle
+		}
+		time.Sleep(wait)
+		last = at
+		io.WriteString(out, data)
+	}
+	return scanner.Err()
+}
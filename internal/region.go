@@ -0,0 +1,276 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/viper"
+)
+
+type regionInfo struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+type regionCache struct {
+	Updated time.Time    `json:"updated"`
+	Regions []regionInfo `json:"regions"`
+}
+
+// regionCaches holds the DescribeRegions result for each partition, as
+// each only lists the regions of the caller's partition.
+type regionCaches map[string]regionCache
+
+const regionCacheTTL = 7 * 24 * time.Hour
+
+// fallbackRegions is used until DescribeRegions has been cached.
+var fallbackRegions = []string{
+	"af-south-1",
+	"ap-east-1", "ap-northeast-1", "ap-northeast-2", "ap-northeast-3",
+	"ap-south-1", "ap-south-2", "ap-southeast-1", "ap-southeast-2",
+	"ap-southeast-3", "ap-southeast-4", "ap-southeast-5", "ap-southeast-7",
+	"ca-central-1", "ca-west-1",
+	"eu-central-1", "eu-central-2", "eu-north-1", "eu-south-1", "eu-south-2",
+	"eu-west-1", "eu-west-2", "eu-west-3",
+	"il-central-1",
+	"me-central-1", "me-south-1",
+	"mx-central-1",
+	"sa-east-1",
+	"us-east-1", "us-east-2", "us-west-1", "us-west-2",
+	"cn-north-1", "cn-northwest-1",
+	"us-gov-east-1", "us-gov-west-1",
+	"us-iso-east-1", "us-iso-west-1", "us-isob-east-1",
+}
+
+// Regions returns the regions requested with --region, expanding a comma
+// separated list or "all".
+func Regions() []string {
+	requested := viper.GetString("region")
+	if requested == "all" {
+		return enabledRegions()
+	}
+
+	regions := []string{}
+	for _, region := range strings.Split(requested, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// regionName matches anything shaped like a region name. Whether the
+// region exists is left to the endpoint resolver and the credential check,
+// as regions in partitions no client has listed yet can't be known here.
+var regionName = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+func validateRegion(region string) bool {
+	return regionName.MatchString(region)
+}
+
+// knownRegions returns the cached regions of each partition a client has
+// been created in, and fallbackRegions for the other partitions.
+func knownRegions() []regionInfo {
+	caches, err := readRegionCache()
+	if err != nil {
+		caches = regionCaches{}
+	}
+
+	regions := []regionInfo{}
+	for _, name := range fallbackRegions {
+		if _, ok := caches[partition(name)]; !ok {
+			regions = append(regions, regionInfo{Name: name, Enabled: true})
+		}
+	}
+	for _, cache := range caches {
+		regions = append(regions, cache.Regions...)
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Name < regions[j].Name })
+	return regions
+}
+
+// enabledRegions returns the regions the account can use, which excludes
+// opt-in regions that haven't been enabled once the cache is populated.
+func enabledRegions() []string {
+	regions := []string{}
+	for _, region := range knownRegions() {
+		if region.Enabled && partition(region.Name) == "aws" {
+			regions = append(regions, region.Name)
+		}
+	}
+	return regions
+}
+
+func partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	case strings.HasPrefix(region, "us-isof-"):
+		return "aws-iso-f"
+	case strings.HasPrefix(region, "eu-isoe-"):
+		return "aws-iso-e"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	default:
+		return "aws"
+	}
+}
+
+func regionCachePath() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "awsclihelper", "regions.json"), nil
+}
+
+func readRegionCache() (regionCaches, error) {
+	path, err := regionCachePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	caches := regionCaches{}
+	if err := json.Unmarshal(data, &caches); err != nil {
+		return nil, err
+	}
+	return caches, nil
+}
+
+// refreshRegions replaces the cached region list for the client's
+// partition with DescribeRegions once it is older than a week. Failures
+// keep the existing list.
+func (c *Client) refreshRegions() {
+	caches, err := readRegionCache()
+	if err != nil {
+		caches = regionCaches{}
+	}
+	if cache, ok := caches[partition(c.Region)]; ok && time.Since(cache.Updated) < regionCacheTTL {
+		return
+	}
+
+	output, err := c.EC2.DescribeRegions(context.TODO(), &ec2.DescribeRegionsInput{
+		AllRegions: aws.Bool(true),
+	})
+	if err != nil {
+		return
+	}
+
+	cache := regionCache{Updated: time.Now()}
+	for _, region := range output.Regions {
+		status := aws.ToString(region.OptInStatus)
+		cache.Regions = append(cache.Regions, regionInfo{
+			Name:    aws.ToString(region.RegionName),
+			Enabled: status == "opt-in-not-required" || status == "opted-in",
+		})
+	}
+	sort.Slice(cache.Regions, func(i, j int) bool { return cache.Regions[i].Name < cache.Regions[j].Name })
+	caches[partition(c.Region)] = cache
+
+	path, err := regionCachePath()
+	if err != nil {
+		return
+	}
+	data, _ := json.Marshal(caches)
+	if os.MkdirAll(filepath.Dir(path), 0700) == nil {
+		ioutil.WriteFile(path, data, 0600)
+	}
+}
+
+// NewClients returns a client for each region requested with --region.
+// The first client is built on its own so that any MFA prompt is answered
+// once and cached, then the rest are built concurrently.
+func NewClients() ([]*Client, error) {
+	regions := Regions()
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("no regions selected")
+	}
+	profile, _ := getProfile()
+
+	clients := make([]*Client, len(regions))
+	errs := make([]error, len(regions))
+	if clients[0], errs[0] = newClient(profile, regions[0]); errs[0] != nil {
+		return nil, errs[0]
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i < len(regions); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i], errs[i] = newClient(profile, regions[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return clients, nil
+}
+
+// Labelled runs fn against every client concurrently and returns the items
+// it produced, each recording the client it came from. When more than one
+// region is in use each label is prefixed with its region.
+func Labelled(clients []*Client, fn func(c *Client) []Item) []Item {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	items := []Item{}
+
+	for _, client := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			result := fn(c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, item := range result {
+				item.Client = c
+				if len(clients) > 1 {
+					item.Label = fmt.Sprintf("[%s] %s", c.Region, item.Label)
+					item.Fields = append(item.Fields, c.Region)
+				}
+				items = append(items, item)
+			}
+		}(client)
+	}
+	wg.Wait()
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// RegionHeader prints the regions a multi-region command is running against.
+func RegionHeader(clients []*Client) {
+	if len(clients) == 1 {
+		clients[0].CmdHeader()
+		return
+	}
+	regions := []string{}
+	for _, c := range clients {
+		regions = append(regions, c.Region)
+	}
+	fmt.Println(aurora.Bold(aurora.BrightGreen("Running with Profile ")), aurora.BrightCyan(clients[0].Profile), aurora.BrightGreen("across Regions "), aurora.BrightCyan(strings.Join(regions, ", ")))
+}
@@ -18,7 +18,11 @@ package main
 import (
 	"github.com/jjkirkpatrick/awsclihelper/cmd"
 	_ "github.com/jjkirkpatrick/awsclihelper/cmd/connect"
+	_ "github.com/jjkirkpatrick/awsclihelper/cmd/ec2"
+	_ "github.com/jjkirkpatrick/awsclihelper/cmd/ecs"
+	_ "github.com/jjkirkpatrick/awsclihelper/cmd/param"
 	_ "github.com/jjkirkpatrick/awsclihelper/cmd/pipeline"
+	_ "github.com/jjkirkpatrick/awsclihelper/cmd/sessions"
 )
 
 func main() {